@@ -0,0 +1,25 @@
+terraform {
+  required_providers {
+    archiver = {
+      source = "registry.terraform.io/Wa4h1h/archiver"
+    }
+  }
+}
+
+provider "archiver" {}
+
+ephemeral "archiver_file" "archive" {
+  name = "example.zip"
+  type = "zip"
+
+  include_base64 = true
+
+  file {
+    path = "../../xx/yy.txt"
+  }
+
+  content {
+    text      = "content"
+    file_path = "content.txt"
+  }
+}
@@ -0,0 +1,16 @@
+resource "archiver_file" "lambda" {
+  name = "lambda.zip"
+  type = "zip"
+
+  dir {
+    path = "src"
+  }
+
+  lifecycle {
+    replace_triggered_by = [terraform_data.src_hash]
+  }
+}
+
+resource "terraform_data" "src_hash" {
+  input = provider::archiver::dir_hash("src", "node_modules", "*.log")
+}
@@ -0,0 +1,7 @@
+locals {
+  package = jsondecode(provider::archiver::entry_content("bundle.zip", "package.json"))
+}
+
+output "version" {
+  value = local.package.version
+}
@@ -0,0 +1,3 @@
+output "bundle_files" {
+  value = [for e in provider::archiver::list_entries("bundle.zip") : e.path]
+}
@@ -25,7 +25,7 @@ resource "archiver_file" "archive" {
   }
 
   content {
-    src       = base64encode("content")
+    text      = "content"
     file_path = "content.txt"
   }
 }
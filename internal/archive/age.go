@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+)
+
+// AgeSettings describes who can decrypt an archive encrypted with age
+// either a list of X25519 recipients or a single passphrase.
+type AgeSettings struct {
+	// age X25519 public keys (age1...)
+	Recipients []string
+	// scrypt passphrase, exclusive with Recipients
+	Passphrase string
+}
+
+func (s *AgeSettings) recipients() ([]age.Recipient, error) {
+	if s.Passphrase != "" {
+		if len(s.Recipients) > 0 {
+			return nil, errors.New("error recipients: a passphrase can not be combined with recipients")
+		}
+
+		r, err := age.NewScryptRecipient(s.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("error recipients: create passphrase recipient: %w", err)
+		}
+
+		return []age.Recipient{r}, nil
+	}
+
+	if len(s.Recipients) == 0 {
+		return nil, errors.New("error recipients: no recipient or passphrase")
+	}
+
+	recipients := make([]age.Recipient, 0, len(s.Recipients))
+
+	for _, key := range s.Recipients {
+		r, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("error recipients: parse %s: %w", key, err)
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+// newAgeWriter returns a writer encrypting everything written to it for s
+// Close must be called to flush the last chunk, it does not close w.
+func newAgeWriter(w io.Writer, s *AgeSettings) (io.WriteCloser, error) {
+	recipients, err := s.recipients()
+	if err != nil {
+		return nil, err
+	}
+
+	aw, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("error newAgeWriter: %w", err)
+	}
+
+	return aw, nil
+}
+
+// ValidateAgeRecipient reports whether key is a valid age X25519 recipient.
+func ValidateAgeRecipient(key string) error {
+	_, err := age.ParseX25519Recipient(key)
+
+	return err
+}
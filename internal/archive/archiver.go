@@ -1,26 +1,38 @@
 package archive
 
 import (
+	"archive/tar"
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // make sure we conform to Archiver.
 var (
 	_ Archiver = &ZipArchiver{}
 	_ Archiver = &TarArchiver{}
+
+	_ EntryOwnerSetter = &TarArchiver{}
 )
 
 func GetArchiver(archType string) Archiver {
-	arch, ok := archivers[archType]
+	newArchiver, ok := archivers[archType]
 	if !ok {
 		return nil
 	}
 
-	return arch
+	return newArchiver()
 }
 
 func WithExcludeList(list []string) Options {
@@ -41,6 +53,244 @@ func WithSymLink(link bool) Options {
 	}
 }
 
+func WithManifest(path, format string) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Manifest = &ManifestSettings{
+			Path:   path,
+			Format: format,
+		}
+	}
+}
+
+func WithEncryption(method, password string) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Encryption = &EncryptionSettings{
+			Method:   method,
+			Password: password,
+		}
+	}
+}
+
+func WithAge(recipients []string, passphrase string) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Age = &AgeSettings{
+			Recipients: recipients,
+			Passphrase: passphrase,
+		}
+	}
+}
+
+func WithConcurrency(workers int) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Concurrency = workers
+	}
+}
+
+func WithOwner(owner *OwnerSettings) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Owner = owner
+	}
+}
+
+func WithTarFormat(format tar.Format) Options {
+	return func(settings *ArchiveSettings) {
+		settings.TarFormat = format
+	}
+}
+
+func WithXattrs(xattrs, acls bool) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Xattrs = &XattrSettings{
+			Xattrs: xattrs,
+			ACLs:   acls,
+		}
+	}
+}
+
+func WithHardLinks(dedupe bool) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Links = &LinkSettings{
+			Dedupe: dedupe,
+		}
+	}
+}
+
+func WithSparse(hashes bool) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Sparse = &SparseSettings{
+			Hashes: hashes,
+		}
+	}
+}
+
+func WithSpecialFiles(write bool) Options {
+	return func(settings *ArchiveSettings) {
+		settings.SpecialFiles = write
+	}
+}
+
+func WithDirEntries(all bool, mode os.FileMode) Options {
+	return func(settings *ArchiveSettings) {
+		settings.Dirs = &DirSettings{
+			All:  all,
+			Mode: mode,
+		}
+	}
+}
+
+// resolveSrc reports whether src is excluded
+// and evaluates src if it is a symbolic link and SymLink is set to true.
+func resolveSrc(settings *ArchiveSettings, src string) (string, bool, error) {
+	if slices.Contains(settings.ExcludeList, src) {
+		return "", true, nil
+	}
+
+	if settings.SymLink {
+		resolved, err := evaluateSymLink(src)
+		if err != nil {
+			return "", false, err
+		}
+
+		return resolved, false, nil
+	}
+
+	return src, false, nil
+}
+
+// DirSettings selects the directories ArchiveDir writes an entry for.
+type DirSettings struct {
+	// every directory, only the empty ones if false
+	All bool
+	// mode of the directory entries, their original mode if 0
+	Mode os.FileMode
+}
+
+// dirEntry is a file found by collectDirEntries
+// src is its absolute path and dst its path inside the archive.
+type dirEntry struct {
+	src string
+	dst string
+	// set for directory entries, written with mode and modTime.
+	dir     bool
+	mode    os.FileMode
+	modTime time.Time
+	// device, named pipe or socket, see specialFile
+	special bool
+}
+
+// archivePath returns the path of p inside the archive, starting at dst.
+func archivePath(p, dst string) string {
+	if i := strings.Index(p, dst); i != -1 {
+		return p[i:]
+	}
+
+	return p
+}
+
+// newDirHeaderEntry returns the entry of the directory src
+// with the mode set in settings or its original mode.
+func newDirHeaderEntry(settings *DirSettings, src, dst string) (dirEntry, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return dirEntry{}, fmt.Errorf("error ArchiveDir: get info %s: %w", src, err)
+	}
+
+	mode := settings.Mode
+	if mode == 0 {
+		mode = info.Mode().Perm()
+	}
+
+	return dirEntry{
+		src:     src,
+		dst:     archivePath(src, dst),
+		dir:     true,
+		mode:    mode,
+		modTime: info.ModTime(),
+	}, nil
+}
+
+// collectDirEntries loops recursively through src path and returns every
+// encountered file in lexical order, excluded directories are skipped
+// and every symbolic link to a directory is evaluated if SymLink is set to true.
+// directories are returned before their files when Dirs is set, only
+// the ones without any returned file unless All is set.
+func collectDirEntries(ctx context.Context, settings *ArchiveSettings, l *entryLog,
+	src, dst string,
+) ([]dirEntry, error) {
+	src, excluded, err := resolveSrc(settings, src)
+	if err != nil || excluded {
+		if excluded {
+			l.exclude()
+		}
+
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return nil, fmt.Errorf("error ArchiveDir: read dirs under %s: %w", src, err)
+	}
+
+	files := make([]dirEntry, 0, len(entries)+1)
+
+	if settings.Dirs != nil {
+		dir, err := newDirHeaderEntry(settings.Dirs, src, dst)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, dir)
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		tmpPath := filepath.Join(src, entry.Name())
+
+		if !entry.IsDir() {
+			// excluded files are dropped before the directory emptiness check.
+			if slices.Contains(settings.ExcludeList, tmpPath) {
+				l.exclude()
+
+				continue
+			}
+
+			files = append(files, dirEntry{
+				src:     tmpPath,
+				dst:     archivePath(tmpPath, dst),
+				special: entry.Type()&specialTypes != 0,
+			})
+		} else {
+			subFiles, err := collectDirEntries(ctx, settings, l, tmpPath, dst)
+			if err != nil {
+				if isContextError(err) {
+					return nil, err
+				}
+
+				log.Printf("error ArchiveDir: read dir %s: %s", tmpPath, err)
+
+				l.skip(tmpPath, err)
+			}
+
+			files = append(files, subFiles...)
+		}
+	}
+
+	// a directory with written files is created when they are extracted
+	// skipped special files do not make it non empty.
+	written := func(e dirEntry) bool {
+		return !e.special || settings.SpecialFiles
+	}
+
+	if settings.Dirs != nil && !settings.Dirs.All && slices.ContainsFunc(files[1:], written) {
+		files = files[1:]
+	}
+
+	return files, nil
+}
+
 // evaluateSymLink takes in an absolute path link
 // evaluates the symbolic link and returns the underlying absolute path.
 func evaluateSymLink(link string) (string, error) {
@@ -69,6 +319,74 @@ func evaluateSymLink(link string) (string, error) {
 	return absPath, nil
 }
 
+// contextReader wraps an io.Reader and checks the context
+// before every read, so a long io.Copy can be interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
+
+// copyWithContext behaves like io.Copy but stops as soon as ctx is done.
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return io.Copy(dst, &contextReader{ctx: ctx, r: src})
+}
+
+// isContextError reports whether err was caused by a cancelled
+// or timed out context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// createTmpArchive creates the temporary file an archive named name
+// is written to, the file is moved to name by commitTmpArchive.
+func createTmpArchive(name string, mode os.FileMode) (*os.File, error) {
+	tmpName := name + tmpArchiveSuffix
+
+	if err := os.Remove(tmpName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error createTmpArchive: remove stale %s: %w", tmpName, err)
+	}
+
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_EXCL|os.O_RDWR, mode)
+	if err != nil {
+		return nil, fmt.Errorf("error createTmpArchive: create %s: %w", tmpName, err)
+	}
+
+	return f, nil
+}
+
+// commitTmpArchive moves the already closed temporary archive to name
+// if ctx is still alive, otherwise the temporary archive is removed.
+func commitTmpArchive(ctx context.Context, tmpName, name string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Join(err, removeTmpArchive(tmpName))
+	}
+
+	if err := os.Rename(tmpName, name); err != nil {
+		return errors.Join(
+			fmt.Errorf("error commitTmpArchive: move %s to %s: %w", tmpName, name, err),
+			removeTmpArchive(tmpName))
+	}
+
+	return nil
+}
+
+func removeTmpArchive(tmpName string) error {
+	if err := os.Remove(tmpName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removeTmpArchive: remove %s: %w", tmpName, err)
+	}
+
+	return nil
+}
+
 // resolveExcludeList takes a list of absolute/relative paths
 // returns a list of absolute paths.
 func resolveExcludeList(list []string) ([]string, error) {
@@ -86,6 +404,16 @@ func resolveExcludeList(list []string) ([]string, error) {
 	return newExcludeList, nil
 }
 
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
 func MD5(b []byte) string {
 	return fmt.Sprintf("%x", md5.Sum(b))
 }
@@ -110,3 +438,39 @@ func Size(file string) (int64, error) {
 
 	return stats.Size(), nil
 }
+
+// ErrTooBig is wrapped by the errors of archives
+// bigger than the size they are encoded for.
+var ErrTooBig = errors.New("size limit exceeded")
+
+// Base64 returns the base64 encoded content of file,
+// failing when file is bigger than maxSize bytes.
+func Base64(file string, maxSize int64) (string, error) {
+	size, err := Size(file)
+	if err != nil {
+		return "", fmt.Errorf("error Base64: %w", err)
+	}
+
+	if size > maxSize {
+		return "", fmt.Errorf("error Base64: %s is %s, more than %s: %w",
+			file, FormatSize(size), FormatSize(maxSize), ErrTooBig)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("error Base64: read %s: %w", file, err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Base64Bytes returns the base64 encoded content b of file,
+// failing when b is bigger than maxSize bytes.
+func Base64Bytes(file string, b []byte, maxSize int64) (string, error) {
+	if size := int64(len(b)); size > maxSize {
+		return "", fmt.Errorf("error Base64Bytes: %s is %s, more than %s: %w",
+			file, FormatSize(size), FormatSize(maxSize), ErrTooBig)
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
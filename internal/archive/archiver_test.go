@@ -4,16 +4,30 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"filippo.io/age"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 var dirTestCases = []struct {
@@ -176,13 +190,13 @@ func TestZipArchive_ArchiveFile(t *testing.T) {
 
 			src, dst := testCase.routine(t)
 
-			err := a.Open("test.zip",
+			err := a.Open(context.Background(), "test.zip",
 				WithFileMode(0o666),
 				WithSymLink(true))
 
 			require.Nil(t, err)
 
-			err = errors.Join(a.ArchiveFile(src, dst), a.Close())
+			err = errors.Join(a.ArchiveFile(context.Background(), src, dst), a.Close(context.Background()))
 
 			require.Nil(t, err)
 
@@ -208,13 +222,13 @@ func TestZipArchive_ArchiveDir(t *testing.T) {
 
 			src, dst := testCase.routine(t)
 
-			err := a.Open("test.zip",
+			err := a.Open(context.Background(), "test.zip",
 				WithFileMode(0o666),
 				WithSymLink(true))
 
 			require.Nil(t, err)
 
-			err = errors.Join(a.ArchiveDir(src, dst), a.Close())
+			err = errors.Join(a.ArchiveDir(context.Background(), src, dst), a.Close(context.Background()))
 
 			require.Nil(t, err)
 
@@ -250,13 +264,13 @@ func TestZipArchive_ArchiveContent(t *testing.T) {
 
 			b, dst := testCase.routine(t)
 
-			err := a.Open("test.zip",
+			err := a.Open(context.Background(), "test.zip",
 				WithFileMode(0o666),
 				WithSymLink(true))
 
 			require.Nil(t, err)
 
-			err = errors.Join(a.ArchiveContent(b, dst), a.Close())
+			err = errors.Join(a.ArchiveContent(context.Background(), b, dst, DefaultContentMode), a.Close(context.Background()))
 
 			require.Nil(t, err)
 
@@ -298,11 +312,11 @@ func TestTarArchiver_ArchiveFile(t *testing.T) {
 
 			src, dst := testCase.routine(t)
 
-			err := a.Open("test.tar.gz")
+			err := a.Open(context.Background(), "test.tar.gz")
 
 			require.Nil(t, err)
 
-			err = errors.Join(a.ArchiveFile(src, dst), a.Close())
+			err = errors.Join(a.ArchiveFile(context.Background(), src, dst), a.Close(context.Background()))
 
 			require.Nil(t, err)
 
@@ -328,11 +342,11 @@ func TestTarArchiver_ArchiveDir(t *testing.T) {
 
 			src, dst := testCase.routine(t)
 
-			err := a.Open("test.tar.gz", WithSymLink(true))
+			err := a.Open(context.Background(), "test.tar.gz", WithSymLink(true))
 
 			require.Nil(t, err)
 
-			err = errors.Join(a.ArchiveDir(src, dst), a.Close())
+			err = errors.Join(a.ArchiveDir(context.Background(), src, dst), a.Close(context.Background()))
 
 			require.Nil(t, err)
 
@@ -368,11 +382,11 @@ func TestTarArchiver_ArchiveContent(t *testing.T) {
 
 			b, dst := testCase.routine(t)
 
-			err := a.Open("test.tar.gz")
+			err := a.Open(context.Background(), "test.tar.gz")
 
 			require.Nil(t, err)
 
-			err = errors.Join(a.ArchiveContent(b, dst), a.Close())
+			err = errors.Join(a.ArchiveContent(context.Background(), b, dst, DefaultContentMode), a.Close(context.Background()))
 
 			require.Nil(t, err)
 
@@ -406,3 +420,859 @@ func TestTarArchiver_ArchiveContent(t *testing.T) {
 		})
 	}
 }
+
+func TestArchiver_ArchiveDirCancelled(t *testing.T) {
+	for _, archType := range []string{"zip", "tar.gz"} {
+		t.Run(archType, func(t *testing.T) {
+			name := "test." + archType
+
+			t.Cleanup(func() {
+				os.Remove(name)
+			})
+
+			a := GetArchiver(archType)
+
+			src, err := filepath.Abs("../../internal/testdata")
+
+			require.Nil(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+
+			err = a.Open(ctx, name)
+
+			require.Nil(t, err)
+
+			cancel()
+
+			err = a.ArchiveDir(ctx, src, "testdata")
+
+			assert.ErrorIs(t, err, context.Canceled)
+
+			err = a.Close(ctx)
+
+			assert.ErrorIs(t, err, context.Canceled)
+
+			_, err = os.Stat(name)
+
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			_, err = os.Stat(name + tmpArchiveSuffix)
+
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+// readArchive returns the name and content of every entry in order.
+func readArchive(t *testing.T, archType, name string) ([]string, [][]byte) {
+	t.Helper()
+
+	names := make([]string, 0)
+	contents := make([][]byte, 0)
+
+	if archType == "zip" {
+		reader, err := zip.OpenReader(name)
+
+		require.Nil(t, err)
+
+		defer reader.Close()
+
+		for _, f := range reader.File {
+			rc, err := f.Open()
+
+			require.Nil(t, err)
+
+			b, err := io.ReadAll(rc)
+
+			require.Nil(t, err)
+
+			names = append(names, f.Name)
+			contents = append(contents, b)
+		}
+
+		return names, contents
+	}
+
+	f, err := os.Open(name)
+
+	require.Nil(t, err)
+
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+
+	require.Nil(t, err)
+
+	r := tar.NewReader(gr)
+
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.Nil(t, err)
+
+		b, err := io.ReadAll(r)
+
+		require.Nil(t, err)
+
+		names = append(names, h.Name)
+		contents = append(contents, b)
+	}
+
+	return names, contents
+}
+
+func TestArchiver_ArchiveDirConcurrency(t *testing.T) {
+	src := t.TempDir()
+
+	for i := 0; i < 40; i++ {
+		dir := filepath.Join(src, fmt.Sprintf("dir%d", i%4))
+
+		require.Nil(t, os.MkdirAll(dir, 0o755))
+
+		// a few entries span several parallel gzip blocks.
+		content := bytes.Repeat([]byte(fmt.Sprintf("file %d\n", i)), i*i*100)
+
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%02d.txt", i)), content, 0o644)
+
+		require.Nil(t, err)
+	}
+
+	for _, archType := range []string{"zip", "tar.gz"} {
+		t.Run(archType, func(t *testing.T) {
+			var (
+				expectedNames    []string
+				expectedContents [][]byte
+				expectedArchive  []byte
+			)
+
+			for _, workers := range []int{1, 8} {
+				name := filepath.Join(t.TempDir(), "test."+archType)
+
+				a := GetArchiver(archType)
+
+				err := a.Open(context.Background(), name, WithConcurrency(workers))
+
+				require.Nil(t, err)
+
+				err = errors.Join(a.ArchiveDir(context.Background(), src, filepath.Base(src)),
+					a.Close(context.Background()))
+
+				require.Nil(t, err)
+
+				names, contents := readArchive(t, archType, name)
+
+				require.Equal(t, 40, len(names))
+
+				assert.True(t, slices.IsSorted(names))
+
+				archive, err := os.ReadFile(name)
+
+				require.Nil(t, err)
+
+				if expectedNames == nil {
+					expectedNames, expectedContents, expectedArchive = names, contents, archive
+
+					continue
+				}
+
+				assert.Equal(t, expectedNames, names)
+				assert.Equal(t, expectedContents, contents)
+				assert.Equal(t, expectedArchive, archive)
+			}
+		})
+	}
+}
+
+func TestArchiver_Manifest(t *testing.T) {
+	for _, archType := range []string{"zip", "tar.gz"} {
+		for _, format := range []string{ManifestFormatJSON, ManifestFormatSHA256Sum} {
+			t.Run(archType+"_"+format, func(t *testing.T) {
+				name := filepath.Join(t.TempDir(), "test."+archType)
+
+				src, err := filepath.Abs("../../internal/testdata")
+
+				require.Nil(t, err)
+
+				a := GetArchiver(archType)
+
+				err = a.Open(context.Background(), name, WithManifest("MANIFEST", format))
+
+				require.Nil(t, err)
+
+				err = errors.Join(a.ArchiveDir(context.Background(), src, "testdata"),
+					a.ArchiveContent(context.Background(), byteInput, "content.txt", DefaultContentMode),
+					a.Close(context.Background()))
+
+				require.Nil(t, err)
+
+				names, contents := readArchive(t, archType, name)
+
+				require.Equal(t, "MANIFEST", names[len(names)-1])
+
+				entries := make(map[string]string)
+
+				for i, n := range names[:len(names)-1] {
+					sum, err := SHA256(contents[i])
+
+					require.Nil(t, err)
+
+					entries[n] = sum
+				}
+
+				manifest := contents[len(contents)-1]
+				parsed := make(map[string]string)
+
+				if format == ManifestFormatJSON {
+					var doc manifestDocument
+
+					require.Nil(t, json.Unmarshal(manifest, &doc))
+
+					for i, e := range doc.Entries {
+						assert.Equal(t, int64(len(contents[i])), e.Size)
+
+						parsed[e.Path] = e.SHA256
+					}
+				} else {
+					for _, line := range strings.Split(strings.TrimSpace(string(manifest)), "\n") {
+						sum, path, ok := strings.Cut(line, "  ")
+
+						require.True(t, ok)
+
+						parsed[path] = sum
+					}
+				}
+
+				assert.Equal(t, entries, parsed)
+			})
+		}
+	}
+}
+
+func TestArchiver_ManifestPathCollision(t *testing.T) {
+	for _, archType := range []string{"zip", "tar.gz"} {
+		t.Run(archType, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test."+archType)
+
+			a := GetArchiver(archType)
+
+			require.Nil(t, a.Open(context.Background(), name, WithManifest("MANIFEST.json", ManifestFormatJSON)))
+
+			require.Nil(t, a.ArchiveContent(context.Background(), byteInput, "MANIFEST.json", DefaultContentMode))
+
+			err := a.Close(context.Background())
+
+			assert.ErrorContains(t, err, "MANIFEST.json is an entry of the archive")
+
+			_, err = os.Stat(name)
+
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+// decryptZipEntry reverses encryptAES and encryptZipCrypto
+// and inflates the decrypted data.
+func decryptZipEntry(t *testing.T, f *zip.File, password string) []byte {
+	t.Helper()
+
+	rc, err := f.OpenRaw()
+
+	require.Nil(t, err)
+
+	raw, err := io.ReadAll(rc)
+
+	require.Nil(t, err)
+
+	require.Equal(t, uint16(zipFlagEncrypted), f.Flags&zipFlagEncrypted)
+
+	var compressed []byte
+
+	if f.Method == zipMethodAES {
+		salt := raw[:zipAESSaltSize]
+		encrypted := raw[zipAESSaltSize+zipAESVerifierSize : len(raw)-zipAESMACSize]
+
+		keys := pbkdf2.Key([]byte(password), salt, zipAESIterations,
+			2*zipAESKeySize+zipAESVerifierSize, sha1.New)
+
+		require.Equal(t, keys[2*zipAESKeySize:], raw[zipAESSaltSize:zipAESSaltSize+zipAESVerifierSize])
+
+		mac := hmac.New(sha1.New, keys[zipAESKeySize:2*zipAESKeySize])
+		mac.Write(encrypted)
+
+		require.Equal(t, mac.Sum(nil)[:zipAESMACSize], raw[len(raw)-zipAESMACSize:])
+
+		block, err := aes.NewCipher(keys[:zipAESKeySize])
+
+		require.Nil(t, err)
+
+		compressed = make([]byte, len(encrypted))
+
+		for i := 0; i < len(encrypted); i += aes.BlockSize {
+			var counter, keyStream [aes.BlockSize]byte
+
+			binary.LittleEndian.PutUint64(counter[:], uint64(i/aes.BlockSize+1))
+			block.Encrypt(keyStream[:], counter[:])
+
+			for j := i; j < min(i+aes.BlockSize, len(encrypted)); j++ {
+				compressed[j] = encrypted[j] ^ keyStream[j-i]
+			}
+		}
+	} else {
+		keys := newZipCryptoKeys(password)
+		plain := make([]byte, 0, len(raw))
+
+		for _, c := range raw {
+			k := keys[2] | 2
+			p := c ^ byte((k*(k^1))>>8)
+			keys.update(p)
+			plain = append(plain, p)
+		}
+
+		check := byte(f.CRC32 >> 24)
+		if f.Flags&zipFlagDataDescriptor != 0 {
+			check = byte(f.ModifiedTime >> 8)
+		}
+
+		require.Equal(t, check, plain[zipCryptoHeaderSize-1])
+
+		compressed = plain[zipCryptoHeaderSize:]
+	}
+
+	b, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+
+	require.Nil(t, err)
+
+	return b
+}
+
+func TestZipArchiver_Encryption(t *testing.T) {
+	for _, method := range []string{ZipEncryptionAES256, ZipEncryptionZipCrypto} {
+		t.Run(method, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test.zip")
+
+			src, err := filepath.Abs("../../internal/testdata/file.txt")
+
+			require.Nil(t, err)
+
+			expected, err := os.ReadFile(src)
+
+			require.Nil(t, err)
+
+			// files bigger than maxBufferedEntrySize are encrypted while streamed.
+			dir := filepath.Join(t.TempDir(), "dir")
+			big := bytes.Repeat([]byte("big"), maxBufferedEntrySize)
+
+			require.Nil(t, os.Mkdir(dir, 0o755))
+			require.Nil(t, os.WriteFile(filepath.Join(dir, "big.bin"), big, 0o644))
+
+			a := GetArchiver("zip")
+
+			err = a.Open(context.Background(), name, WithEncryption(method, "secret"))
+
+			require.Nil(t, err)
+
+			err = errors.Join(a.ArchiveFile(context.Background(), src, "file.txt"),
+				a.ArchiveContent(context.Background(), byteInput, "content.txt", DefaultContentMode),
+				a.ArchiveDir(context.Background(), dir, "dir"),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			reader, err := zip.OpenReader(name)
+
+			require.Nil(t, err)
+
+			t.Cleanup(func() {
+				reader.Close()
+			})
+
+			require.Equal(t, 3, len(reader.File))
+
+			assert.Equal(t, expected, decryptZipEntry(t, reader.File[0], "secret"))
+			assert.Equal(t, byteInput, decryptZipEntry(t, reader.File[1], "secret"))
+			assert.Equal(t, big, decryptZipEntry(t, reader.File[2], "secret"))
+
+			assert.Equal(t, int64(len(big)), a.Entries()[2].Size)
+			assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(big)), a.Entries()[2].SHA256)
+		})
+	}
+}
+
+func TestTarArchiver_Age(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+
+	require.Nil(t, err)
+
+	name := filepath.Join(t.TempDir(), "test.tar.gz.age")
+
+	a := &TarArchiver{}
+
+	err = a.Open(context.Background(), name,
+		WithAge([]string{identity.Recipient().String()}, ""))
+
+	require.Nil(t, err)
+
+	err = errors.Join(a.ArchiveContent(context.Background(), byteInput, "content.txt", DefaultContentMode),
+		a.Close(context.Background()))
+
+	require.Nil(t, err)
+
+	f, err := os.Open(name)
+
+	require.Nil(t, err)
+
+	t.Cleanup(func() {
+		f.Close()
+	})
+
+	r, err := age.Decrypt(f, identity)
+
+	require.Nil(t, err)
+
+	plain, err := io.ReadAll(r)
+
+	require.Nil(t, err)
+
+	plainMD5, plainSHA256, encrypted := a.PlaintextChecksums()
+
+	require.True(t, encrypted)
+
+	sha, err := SHA256(plain)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, sha, plainSHA256)
+	assert.Equal(t, MD5(plain), plainMD5)
+
+	gr, err := gzip.NewReader(bytes.NewReader(plain))
+
+	require.Nil(t, err)
+
+	tr := tar.NewReader(gr)
+
+	header, err := tr.Next()
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "content.txt", header.Name)
+
+	b, err := io.ReadAll(tr)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, byteInput, b)
+}
+
+func TestArchiveContent_Mode(t *testing.T) {
+	for _, archType := range []string{"zip", "tar.gz"} {
+		t.Run(archType, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test."+archType)
+
+			a := GetArchiver(archType)
+
+			err := a.Open(context.Background(), name)
+
+			require.Nil(t, err)
+
+			err = errors.Join(a.ArchiveContent(context.Background(), byteInput, "run.sh", 0o755),
+				a.ArchiveContent(context.Background(), byteInput, "content.txt", DefaultContentMode),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			modes := make([]os.FileMode, 0, 2)
+
+			if archType == "zip" {
+				reader, err := zip.OpenReader(name)
+
+				require.Nil(t, err)
+
+				t.Cleanup(func() {
+					reader.Close()
+				})
+
+				for _, f := range reader.File {
+					modes = append(modes, f.Mode().Perm())
+				}
+			} else {
+				f, err := os.Open(name)
+
+				require.Nil(t, err)
+
+				t.Cleanup(func() {
+					f.Close()
+				})
+
+				gr, err := gzip.NewReader(f)
+
+				require.Nil(t, err)
+
+				tr := tar.NewReader(gr)
+
+				for {
+					header, err := tr.Next()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+
+					require.Nil(t, err)
+
+					modes = append(modes, os.FileMode(header.Mode))
+				}
+			}
+
+			assert.Equal(t, []os.FileMode{0o755, DefaultContentMode}, modes)
+		})
+	}
+}
+
+func TestArchiver_Stats(t *testing.T) {
+	for _, archType := range []string{"zip", "tar.gz"} {
+		t.Run(archType, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src")
+
+			require.Nil(t, os.MkdirAll(filepath.Join(src, "excluded"), 0o755))
+			require.Nil(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("aaaa"), 0o644))
+			require.Nil(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("bb"), 0o644))
+			require.Nil(t, os.WriteFile(filepath.Join(src, "excluded", "c.txt"), []byte("c"), 0o644))
+			require.Nil(t, os.Symlink(filepath.Join(dir, "missing"), filepath.Join(src, "broken")))
+
+			name := filepath.Join(dir, "test."+archType)
+
+			a := GetArchiver(archType)
+
+			err := a.Open(context.Background(), name,
+				WithSymLink(true),
+				WithExcludeList([]string{filepath.Join(src, "b.txt"), filepath.Join(src, "excluded")}))
+
+			require.Nil(t, err)
+
+			err = errors.Join(a.ArchiveDir(context.Background(), src, "src"),
+				a.ArchiveContent(context.Background(), []byte("content"), "content.txt", DefaultContentMode),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			stats := a.Stats()
+
+			assert.Equal(t, 2, stats.EntryCount)
+			assert.Equal(t, int64(len("aaaa")+len("content")), stats.UncompressedSize)
+			assert.Equal(t, 2, stats.ExcludedCount)
+
+			entries := a.Entries()
+
+			require.Len(t, entries, 2)
+
+			assert.Equal(t, "src/a.txt", entries[0].Path)
+			assert.Equal(t, "content.txt", entries[1].Path)
+			assert.Equal(t, DefaultContentMode, entries[1].Mode)
+
+			require.Len(t, stats.Skipped, 1)
+
+			assert.Equal(t, filepath.Join(src, "broken"), stats.Skipped[0].Path)
+			assert.NotEmpty(t, stats.Skipped[0].Reason)
+		})
+	}
+}
+
+func TestBase64(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.zip")
+
+	require.Nil(t, os.WriteFile(name, []byte("archive"), 0o644))
+
+	encoded, err := Base64(name, int64(len("archive")))
+
+	require.Nil(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("archive")), encoded)
+
+	_, err = Base64(name, int64(len("archive")-1))
+
+	assert.ErrorIs(t, err, ErrTooBig)
+
+	encoded, err = Base64Bytes(name, []byte("archive"), int64(len("archive")))
+
+	require.Nil(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("archive")), encoded)
+
+	_, err = Base64Bytes(name, []byte("archive"), int64(len("archive")-1))
+
+	assert.ErrorIs(t, err, ErrTooBig)
+
+	_, err = Base64(filepath.Join(t.TempDir(), "missing.zip"), int64(len("archive")))
+
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrTooBig)
+}
+
+// readModes returns the mode of every entry of the archive name.
+func readModes(t *testing.T, archType, name string) map[string]os.FileMode {
+	t.Helper()
+
+	modes := make(map[string]os.FileMode)
+
+	if archType == "zip" {
+		reader, err := zip.OpenReader(name)
+
+		require.Nil(t, err)
+
+		defer reader.Close()
+
+		for _, f := range reader.File {
+			modes[f.Name] = f.Mode()
+		}
+
+		return modes
+	}
+
+	f, err := os.Open(name)
+
+	require.Nil(t, err)
+
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+
+	require.Nil(t, err)
+
+	r := tar.NewReader(gr)
+
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.Nil(t, err)
+
+		modes[h.Name] = h.FileInfo().Mode()
+	}
+
+	return modes
+}
+
+func readModTimes(t *testing.T, archType, name string) map[string]time.Time {
+	t.Helper()
+
+	modTimes := make(map[string]time.Time)
+
+	if archType == "zip" {
+		reader, err := zip.OpenReader(name)
+
+		require.Nil(t, err)
+
+		defer reader.Close()
+
+		for _, f := range reader.File {
+			modTimes[f.Name] = f.Modified
+		}
+
+		return modTimes
+	}
+
+	f, err := os.Open(name)
+
+	require.Nil(t, err)
+
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+
+	require.Nil(t, err)
+
+	r := tar.NewReader(gr)
+
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.Nil(t, err)
+
+		modTimes[h.Name] = h.ModTime
+	}
+
+	return modTimes
+}
+
+func TestArchiver_DirEntries(t *testing.T) {
+	for _, archType := range []string{"zip", "tar.gz"} {
+		t.Run(archType, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "src")
+
+			require.Nil(t, os.MkdirAll(filepath.Join(src, "logs"), 0o750))
+			require.Nil(t, os.MkdirAll(filepath.Join(src, "tmp"), 0o777))
+			require.Nil(t, os.Chmod(filepath.Join(src, "tmp"), 0o777))
+			require.Nil(t, os.MkdirAll(filepath.Join(src, "app"), 0o755))
+			require.Nil(t, os.WriteFile(filepath.Join(src, "app", "main"), []byte("main"), 0o644))
+			// logs only holds excluded files, it is still empty.
+			require.Nil(t, os.WriteFile(filepath.Join(src, "logs", "app.log"), []byte("log"), 0o644))
+
+			modTime := time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)
+
+			require.Nil(t, os.Chtimes(filepath.Join(src, "logs"), modTime, modTime))
+
+			tests := []struct {
+				name     string
+				opt      Options
+				expected map[string]os.FileMode
+			}{
+				{
+					name: "empty",
+					opt:  WithDirEntries(false, 0),
+					expected: map[string]os.FileMode{
+						"src/logs/": os.ModeDir | 0o750,
+						"src/tmp/":  os.ModeDir | 0o777,
+					},
+				},
+				{
+					name: "all",
+					opt:  WithDirEntries(true, 0o700),
+					expected: map[string]os.FileMode{
+						"src/":      os.ModeDir | 0o700,
+						"src/app/":  os.ModeDir | 0o700,
+						"src/logs/": os.ModeDir | 0o700,
+						"src/tmp/":  os.ModeDir | 0o700,
+					},
+				},
+			}
+
+			for _, tt := range tests {
+				name := filepath.Join(dir, tt.name+"."+archType)
+
+				a := GetArchiver(archType)
+
+				require.Nil(t, a.Open(context.Background(), name, tt.opt,
+					WithExcludeList([]string{filepath.Join(src, "logs", "app.log")})))
+
+				err := errors.Join(a.ArchiveDir(context.Background(), src, "src"),
+					a.Close(context.Background()))
+
+				require.Nil(t, err)
+
+				modes := readModes(t, archType, name)
+
+				assert.Equal(t, 1, a.Stats().ExcludedCount, tt.name)
+				assert.True(t, modTime.Equal(readModTimes(t, archType, name)["src/logs/"]), tt.name)
+
+				for entry, mode := range tt.expected {
+					assert.Equal(t, mode, modes[entry], tt.name+" "+entry)
+				}
+
+				assert.Len(t, modes, len(tt.expected)+1, tt.name)
+				assert.Contains(t, modes, "src/app/main", tt.name)
+				assert.Len(t, a.Entries(), 1, tt.name)
+			}
+		})
+	}
+}
+
+func TestTarArchiver_Owner(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "file.txt")
+
+	require.Nil(t, os.WriteFile(src, []byte("file"), 0o644))
+
+	info, err := os.Stat(src)
+
+	require.Nil(t, err)
+
+	// names of the owner of src, as resolved by archive/tar.
+	fileHeader, err := tar.FileInfoHeader(info, "")
+
+	require.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		owner    *OwnerSettings
+		expected map[string][4]any
+	}{
+		{
+			name:  "names",
+			owner: &OwnerSettings{Owner: "app", Group: "app", UID: 0, GID: 0},
+			expected: map[string][4]any{
+				"file.txt":     {"app", "app", 0, 0},
+				"block.txt":    {"app", "app", 1000, 0},
+				"restored.txt": {"app", "app", 0, 0},
+			},
+		},
+		{
+			name:  "numeric",
+			owner: &OwnerSettings{Owner: "app", UID: 10, GID: KeepID, NumericOwner: true},
+			expected: map[string][4]any{
+				"file.txt":     {"", "", 10, os.Getgid()},
+				"block.txt":    {"", "", 1000, 0},
+				"restored.txt": {"", "", 10, 0},
+			},
+		},
+		{
+			name:  "uid",
+			owner: &OwnerSettings{UID: 0, GID: KeepID},
+			expected: map[string][4]any{
+				"file.txt":     {"", fileHeader.Gname, 0, os.Getgid()},
+				"block.txt":    {"", "", 1000, 0},
+				"restored.txt": {"", "", 0, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name+".tar.gz")
+
+			a := GetArchiver("tar.gz")
+
+			require.Nil(t, a.Open(context.Background(), name, WithOwner(tt.owner)))
+
+			s, ok := a.(EntryOwnerSetter)
+
+			require.True(t, ok)
+
+			err := a.ArchiveFile(context.Background(), src, "file.txt")
+
+			require.Nil(t, err)
+
+			s.SetEntryOwner(&OwnerSettings{UID: 1000, GID: KeepID})
+
+			err = a.ArchiveContent(context.Background(), []byte("block"), "block.txt", DefaultContentMode)
+
+			require.Nil(t, err)
+
+			s.SetEntryOwner(nil)
+
+			err = errors.Join(
+				a.ArchiveContent(context.Background(), []byte("restored"), "restored.txt", DefaultContentMode),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			f, err := os.Open(name)
+
+			require.Nil(t, err)
+
+			defer f.Close()
+
+			gr, err := gzip.NewReader(f)
+
+			require.Nil(t, err)
+
+			r := tar.NewReader(gr)
+
+			for {
+				h, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				require.Nil(t, err)
+
+				assert.Equal(t, tt.expected[h.Name], [4]any{h.Uname, h.Gname, h.Uid, h.Gid}, h.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumMD5    = "md5"
+)
+
+// manifestMu serializes updates of shared manifests,
+// several archives of the same apply may point to the same SHA256SUMS file.
+var manifestMu sync.Mutex
+
+// checksumLine formats sum and name in the coreutils (sha256sum, md5sum) format.
+func checksumLine(sum, name string) string {
+	return fmt.Sprintf("%s  %s\n", sum, name)
+}
+
+// manifestEntryName returns the path of archive relative to the manifest directory
+// so the manifest can be checked with sha256sum -c from that directory.
+func manifestEntryName(manifest, archive string) string {
+	rel, err := filepath.Rel(filepath.Dir(manifest), archive)
+	if err != nil {
+		return filepath.Base(archive)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// isManifestEntry reports whether the manifest entry name is archive entry
+// or one of its volumes, entry.001, entry.002...
+func isManifestEntry(name, entry string) bool {
+	if name == entry {
+		return true
+	}
+
+	index, ok := strings.CutPrefix(name, entry+".")
+	if !ok || len(index) < 3 {
+		return false
+	}
+
+	return strings.Trim(index, "0123456789") == ""
+}
+
+// ChecksumFilePath returns the path of the algo sidecar file of archive.
+func ChecksumFilePath(archive, algo string) string {
+	return archive + "." + algo
+}
+
+// checksum returns the algo sum of p.
+func (p Part) checksum(algo string) string {
+	if algo == ChecksumMD5 {
+		return p.MD5
+	}
+
+	return p.SHA256
+}
+
+// WriteChecksumFile writes the sidecar file of archive with a line per file,
+// the archive itself or its volumes once split.
+func WriteChecksumFile(archive, algo string, files []Part, mode os.FileMode) (string, error) {
+	name := ChecksumFilePath(archive, algo)
+
+	var lines strings.Builder
+
+	for _, f := range files {
+		lines.WriteString(checksumLine(f.checksum(algo), filepath.Base(f.Path)))
+	}
+
+	err := os.WriteFile(name, []byte(lines.String()), mode)
+	if err != nil {
+		return "", fmt.Errorf("error WriteChecksumFile: write %s: %w", name, err)
+	}
+
+	return name, nil
+}
+
+// rewriteManifest replaces the lines of archive and its volumes in manifest with lines
+// empty lines only remove them, the manifest is removed once empty.
+func rewriteManifest(manifest, archive, lines string, mode os.FileMode) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	entry := manifestEntryName(manifest, archive)
+
+	b, err := os.ReadFile(manifest)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error rewriteManifest: read %s: %w", manifest, err)
+	}
+
+	out := new(bytes.Buffer)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+
+	for scanner.Scan() {
+		_, name, ok := strings.Cut(scanner.Text(), "  ")
+		if ok && isManifestEntry(name, entry) {
+			continue
+		}
+
+		out.WriteString(scanner.Text() + "\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error rewriteManifest: parse %s: %w", manifest, err)
+	}
+
+	out.WriteString(lines)
+
+	if out.Len() == 0 {
+		if err := os.Remove(manifest); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error rewriteManifest: remove %s: %w", manifest, err)
+		}
+
+		return nil
+	}
+
+	tmpName := manifest + tmpArchiveSuffix
+
+	if err := os.WriteFile(tmpName, out.Bytes(), mode); err != nil {
+		return fmt.Errorf("error rewriteManifest: write %s: %w", tmpName, err)
+	}
+
+	if err := os.Rename(tmpName, manifest); err != nil {
+		return errors.Join(
+			fmt.Errorf("error rewriteManifest: move %s to %s: %w", tmpName, manifest, err),
+			removeTmpArchive(tmpName))
+	}
+
+	return nil
+}
+
+// AddToChecksumManifest adds or replaces the sha256 lines of archive
+// in the shared coreutils manifest (SHA256SUMS), a line per file,
+// the archive itself or its volumes once split.
+func AddToChecksumManifest(manifest, archive string, files []Part, mode os.FileMode) error {
+	var lines strings.Builder
+
+	for _, f := range files {
+		lines.WriteString(checksumLine(f.SHA256, manifestEntryName(manifest, f.Path)))
+	}
+
+	return rewriteManifest(manifest, archive, lines.String(), mode)
+}
+
+// RemoveFromChecksumManifest removes the lines of archive and its volumes
+// from the shared manifest.
+func RemoveFromChecksumManifest(manifest, archive string) error {
+	return rewriteManifest(manifest, archive, "", DefaultArchiveMode)
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "SHA256SUMS")
+
+	require.Nil(t, os.WriteFile(manifest, []byte("abc  other.zip\n"), 0o644))
+
+	archive := filepath.Join(dir, "test.zip")
+
+	require.Nil(t, AddToChecksumManifest(manifest, archive, []Part{{Path: archive, SHA256: "111"}}, 0o644))
+	require.Nil(t, AddToChecksumManifest(manifest, archive, []Part{{Path: archive, SHA256: "222"}}, 0o644))
+
+	b, err := os.ReadFile(manifest)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "abc  other.zip\n222  test.zip\n", string(b))
+
+	// the volumes of a split archive replace the archive line.
+	parts := []Part{
+		{Path: PartPath(archive, 1), SHA256: "333"},
+		{Path: PartPath(archive, 2), SHA256: "444"},
+	}
+
+	require.Nil(t, AddToChecksumManifest(manifest, archive, parts, 0o644))
+
+	b, err = os.ReadFile(manifest)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "abc  other.zip\n333  test.zip.001\n444  test.zip.002\n", string(b))
+
+	require.Nil(t, RemoveFromChecksumManifest(manifest, archive))
+
+	b, err = os.ReadFile(manifest)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "abc  other.zip\n", string(b))
+
+	require.Nil(t, RemoveFromChecksumManifest(manifest, filepath.Join(dir, "other.zip")))
+
+	_, err = os.Stat(manifest)
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWriteChecksumFile(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "test.tar.gz")
+
+	name, err := WriteChecksumFile(archive, ChecksumSHA256, []Part{{Path: archive, MD5: "def", SHA256: "abc"}}, 0o644)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, archive+".sha256", name)
+
+	b, err := os.ReadFile(name)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "abc  test.tar.gz\n", string(b))
+
+	parts := []Part{
+		{Path: PartPath(archive, 1), MD5: "111"},
+		{Path: PartPath(archive, 2), MD5: "222"},
+	}
+
+	name, err = WriteChecksumFile(archive, ChecksumMD5, parts, 0o644)
+
+	require.Nil(t, err)
+
+	b, err = os.ReadFile(name)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "111  test.tar.gz.001\n222  test.tar.gz.002\n", string(b))
+}
+
+func TestIsManifestEntry(t *testing.T) {
+	assert.True(t, isManifestEntry("test.zip", "test.zip"))
+	assert.True(t, isManifestEntry("test.zip.001", "test.zip"))
+	assert.True(t, isManifestEntry("test.zip.1000", "test.zip"))
+	assert.False(t, isManifestEntry("test.zip.sig", "test.zip"))
+	assert.False(t, isManifestEntry("test.zip.01", "test.zip"))
+	assert.False(t, isManifestEntry("other.zip.001", "test.zip"))
+}
@@ -1,7 +1,28 @@
 package archive
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 const (
-	DefaultArchiveMode os.FileMode = 0o666
+	DefaultArchiveMode   os.FileMode = 0o666
+	DefaultContentMode   os.FileMode = 0o666
+	DefaultCreateTimeout             = 20 * time.Minute
+	DefaultUpdateTimeout             = 20 * time.Minute
+	DefaultOpenTimeout               = 20 * time.Minute
+	// largest archive output_base64 is set for when base64_max_size is not.
+	DefaultBase64MaxSize = "1MiB"
+	// suffix of the temporary file an archive is written to before
+	// being moved to its final location.
+	tmpArchiveSuffix = ".tmp"
+	// files up to this size are read and compressed in memory by
+	// the ArchiveDir workers, bigger files are streamed in order.
+	maxBufferedEntrySize = 8 << 20
+	// zip version 2.0, needed for deflate.
+	zipVersion20 = 20
+	// zip version 5.1, needed for AES encryption.
+	zipVersion51 = 51
+	// general purpose flag marking a zip entry name as UTF-8.
+	zipFlagUTF8 = 0x800
 )
@@ -0,0 +1,398 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/ephemeral/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// private state key of the temporary directory holding the archive.
+const ephemeralDirKey = "dir"
+
+var (
+	_ ephemeral.EphemeralResource                   = &archiveEphemeralResource{}
+	_ ephemeral.EphemeralResourceWithClose          = &archiveEphemeralResource{}
+	_ ephemeral.EphemeralResourceWithValidateConfig = &archiveEphemeralResource{}
+)
+
+// archiveEphemeralResource builds an archive in a temporary directory
+// removed on close, so it is never stored in the state nor left behind.
+type archiveEphemeralResource struct {
+	builder *archiveResource
+}
+
+func NewArchiveEphemeralResource() ephemeral.EphemeralResource {
+	return &archiveEphemeralResource{
+		builder: &archiveResource{},
+	}
+}
+
+type EphemeralModel struct {
+	Name           types.String `tfsdk:"name"`
+	Type           types.String `tfsdk:"type"`
+	ExcludeList    types.List   `tfsdk:"exclude_list"`
+	ResolveSymLink types.Bool   `tfsdk:"resolve_symlink"`
+	IncludeBase64  types.Bool   `tfsdk:"include_base64"`
+	Base64MaxSize  types.String `tfsdk:"base64_max_size"`
+	FileBlocks     types.Set    `tfsdk:"file"`
+	DirBlocks      types.Set    `tfsdk:"dir"`
+	ContentBlocks  types.Set    `tfsdk:"content"`
+	AbsPath        types.String `tfsdk:"abs_path"`
+	MD5            types.String `tfsdk:"md5"`
+	SHA256         types.String `tfsdk:"sha256"`
+	Size           types.Int64  `tfsdk:"size"`
+	Base64         types.String `tfsdk:"output_base64"`
+	NumericOwner   types.Bool   `tfsdk:"numeric_owner"`
+	// owner of the tar entries, overridden per block
+	EntryOwner
+	Timeouts timeouts.Value `tfsdk:"timeouts"`
+}
+
+func (e *archiveEphemeralResource) Metadata(_ context.Context,
+	req ephemeral.MetadataRequest, resp *ephemeral.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_file"
+}
+
+func (e *archiveEphemeralResource) Schema(ctx context.Context,
+	_ ephemeral.SchemaRequest, resp *ephemeral.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		Description: "Generate a temporary zip/tar.gz archive file, " +
+			"removed once the plan or apply is done",
+		Attributes: map[string]schema.Attribute{
+			"name": schema.StringAttribute{
+				Required:    true,
+				Description: "file name of the produced archive inside its temporary directory",
+			},
+			"type": schema.StringAttribute{
+				Required:    true,
+				Description: "archive type: zip or tar.gz",
+			},
+			"resolve_symlink": schema.BoolAttribute{
+				Optional:    true,
+				Description: "resolve symbolic link: default is false",
+			},
+			"exclude_list": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "list of paths to exclude from the produced archive",
+			},
+			"include_base64": schema.BoolAttribute{
+				Optional:    true,
+				Description: "set output_base64 to the base64 encoded archive: default is false",
+			},
+			"base64_max_size": schema.StringAttribute{
+				Optional: true,
+				Description: "fail when include_base64 is set and the archive is bigger than this size: " +
+					"default is " + DefaultBase64MaxSize,
+			},
+			"abs_path": schema.StringAttribute{
+				Computed:    true,
+				Description: "Output archive absolute path",
+			},
+			"md5": schema.StringAttribute{
+				Computed:    true,
+				Description: "Output file computed MD5",
+			},
+			"sha256": schema.StringAttribute{
+				Computed:    true,
+				Description: "Output file computed SHA256",
+			},
+			"size": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Output file size",
+			},
+			"output_base64": schema.StringAttribute{
+				Computed:    true,
+				Sensitive:   true,
+				Description: "Base64 encoded archive if include_base64 is set",
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx),
+		},
+	}
+
+	for name, a := range ownerAttributes {
+		resp.Schema.Attributes[name] = ephemeralAttribute(a)
+	}
+
+	for name, b := range inputBlocks {
+		resp.Schema.Blocks[name] = schema.SetNestedBlock{
+			Description:  b.description,
+			NestedObject: ephemeralBlockObject(b.attributes),
+		}
+	}
+}
+
+// ephemeralAttribute builds a as an ephemeral resource attribute.
+func ephemeralAttribute(a sharedAttribute) schema.Attribute {
+	switch a.attrType {
+	case types.Int64Type:
+		return schema.Int64Attribute{
+			Required:           a.required,
+			Optional:           !a.required,
+			Description:        a.description,
+			DeprecationMessage: a.deprecation,
+		}
+	case types.BoolType:
+		return schema.BoolAttribute{
+			Required:           a.required,
+			Optional:           !a.required,
+			Description:        a.description,
+			DeprecationMessage: a.deprecation,
+		}
+	default:
+		return schema.StringAttribute{
+			Required:           a.required,
+			Optional:           !a.required,
+			Description:        a.description,
+			DeprecationMessage: a.deprecation,
+		}
+	}
+}
+
+func ephemeralBlockObject(attributes map[string]sharedAttribute) schema.NestedBlockObject {
+	object := schema.NestedBlockObject{
+		Attributes: make(map[string]schema.Attribute, len(attributes)),
+	}
+
+	for name, a := range attributes {
+		object.Attributes[name] = ephemeralAttribute(a)
+	}
+
+	return object
+}
+
+// ValidateConfig rejects the contents and owners the resource rejects,
+// so they fail before the archive is built.
+func (e *archiveEphemeralResource) ValidateConfig(ctx context.Context,
+	req ephemeral.ValidateConfigRequest, resp *ephemeral.ValidateConfigResponse,
+) {
+	tflog.Debug(ctx, "validating ephemeral resource config...")
+
+	var model EphemeralModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !model.Type.IsUnknown() && GetArchiver(model.Type.ValueString()) == nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("type"),
+			"unsupported archive type",
+			fmt.Sprintf("unsupported archive type %s, only zip and tar.gz are supported",
+				model.Type.ValueString()))
+	}
+
+	e.builder.validateContents(ctx, model.ContentBlocks, path.Root("content"), &resp.Diagnostics)
+
+	e.builder.validateOwners(ctx, ownerConfig{
+		Type:          model.Type,
+		NumericOwner:  model.NumericOwner,
+		EntryOwner:    model.EntryOwner,
+		FileBlocks:    model.FileBlocks,
+		DirBlocks:     model.DirBlocks,
+		ContentBlocks: model.ContentBlocks,
+	}, &resp.Diagnostics)
+}
+
+func (e *archiveEphemeralResource) Open(ctx context.Context,
+	req ephemeral.OpenRequest, resp *ephemeral.OpenResponse,
+) {
+	tflog.Debug(ctx, "opening ephemeral archive....")
+
+	var model EphemeralModel
+
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	openTimeout, d := model.Timeouts.Open(ctx, DefaultOpenTimeout)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, openTimeout)
+	defer cancel()
+
+	archiver := GetArchiver(model.Type.ValueString())
+	if archiver == nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("type"),
+			"unsupported archive type",
+			fmt.Sprintf("unsported archive type %s, only zip and tar.gz are supported",
+				model.Type.ValueString()))
+
+		return
+	}
+
+	var (
+		list     = make([]string, 0, len(model.ExcludeList.Elements()))
+		files    = make([]File, 0, len(model.FileBlocks.Elements()))
+		dirs     = make([]Dir, 0, len(model.DirBlocks.Elements()))
+		contents = make([]Content, 0, len(model.ContentBlocks.Elements()))
+	)
+
+	resp.Diagnostics.Append(model.ExcludeList.ElementsAs(ctx, &list, false)...)
+	resp.Diagnostics.Append(model.FileBlocks.ElementsAs(ctx, &files, false)...)
+	resp.Diagnostics.Append(model.DirBlocks.ElementsAs(ctx, &dirs, false)...)
+	resp.Diagnostics.Append(model.ContentBlocks.ElementsAs(ctx, &contents, false)...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "archiver-ephemeral-")
+	if err != nil {
+		resp.Diagnostics.AddError("can not create temporary directory", err.Error())
+
+		return
+	}
+
+	archName := filepath.Join(tmpDir, filepath.Base(model.Name.ValueString()))
+
+	if err := e.build(ctx, archiver, archName, model, list, files, dirs, contents); err != nil {
+		resp.Diagnostics.AddError(
+			fmt.Sprintf("failed to create %s", model.Name.ValueString()),
+			errors.Join(err, os.RemoveAll(tmpDir)).Error())
+
+		return
+	}
+
+	// Close only removes the directory stored in the private state.
+	dirKey, err := json.Marshal(tmpDir)
+	if err != nil {
+		resp.Diagnostics.AddError("can not store temporary directory",
+			errors.Join(err, os.RemoveAll(tmpDir)).Error())
+
+		return
+	}
+
+	if d := resp.Private.SetKey(ctx, ephemeralDirKey, dirKey); d.HasError() {
+		resp.Diagnostics.Append(d...)
+
+		if err := os.RemoveAll(tmpDir); err != nil {
+			resp.Diagnostics.AddError(fmt.Sprintf("can not delete %s", tmpDir), err.Error())
+		}
+
+		return
+	}
+
+	b, err := os.ReadFile(archName)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			fmt.Sprintf("can not read %s", archName),
+			errors.Join(err, os.RemoveAll(tmpDir)).Error())
+
+		return
+	}
+
+	sha256, err := SHA256(b)
+	if err != nil {
+		resp.Diagnostics.AddWarning("computing sha256",
+			fmt.Sprintf("could not compute sha256 output: %s", err))
+	}
+
+	model.AbsPath = types.StringValue(archName)
+	model.MD5 = types.StringValue(MD5(b))
+	model.SHA256 = types.StringValue(sha256)
+	model.Size = types.Int64Value(int64(len(b)))
+	model.Base64 = types.StringNull()
+
+	if model.IncludeBase64.ValueBool() {
+		var d diag.Diagnostics
+
+		// the archive is already read, encoding it does not read it again.
+		model.Base64, d = e.builder.base64Value(model.Base64MaxSize, func(limit int64) (string, error) {
+			return Base64Bytes(archName, b, limit)
+		})
+		resp.Diagnostics.Append(d...)
+
+		if d.HasError() {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				resp.Diagnostics.AddError(fmt.Sprintf("can not delete %s", tmpDir), err.Error())
+			}
+
+			return
+		}
+	}
+
+	resp.Diagnostics.Append(resp.Result.Set(ctx, &model)...)
+}
+
+// build writes the archive archName, a failing content stops the build.
+func (e *archiveEphemeralResource) build(ctx context.Context, archiver Archiver,
+	archName string, model EphemeralModel,
+	list []string, files []File, dirs []Dir, contents []Content,
+) error {
+	err := archiver.Open(ctx, archName,
+		WithFileMode(0o600),
+		WithSymLink(model.ResolveSymLink.ValueBool()),
+		WithExcludeList(list),
+		WithOwner(ownerSettings(model.EntryOwner, model.NumericOwner.ValueBool())))
+	if err != nil {
+		return err
+	}
+
+	err = e.builder.appendFiles(ctx, archiver, files...)
+
+	if err == nil {
+		err = e.builder.appendDirs(ctx, archiver, dirs...)
+	}
+
+	if err == nil {
+		err = e.builder.appendContents(ctx, archiver, contents...)
+	}
+
+	if err != nil {
+		return errors.Join(err, discardArchive(ctx, archiver))
+	}
+
+	return archiver.Close(ctx)
+}
+
+func (e *archiveEphemeralResource) Close(ctx context.Context,
+	req ephemeral.CloseRequest, resp *ephemeral.CloseResponse,
+) {
+	dirKey, d := req.Private.GetKey(ctx, ephemeralDirKey)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() || dirKey == nil {
+		return
+	}
+
+	var tmpDir string
+
+	if err := json.Unmarshal(dirKey, &tmpDir); err != nil {
+		resp.Diagnostics.AddError("can not read temporary directory", err.Error())
+
+		return
+	}
+
+	tflog.Debug(ctx, "removing ephemeral archive....", map[string]interface{}{
+		"dir": tmpDir,
+	})
+
+	if err := os.RemoveAll(tmpDir); err != nil {
+		resp.Diagnostics.AddError(
+			"can not delete archive",
+			fmt.Sprintf("can not delete %s: %s", tmpDir, err))
+	}
+}
@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	ephemeralschema "github.com/hashicorp/terraform-plugin-framework/ephemeral/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveEphemeralResource_SchemaMatchesResource(t *testing.T) {
+	var (
+		resourceResp  resource.SchemaResponse
+		ephemeralResp ephemeral.SchemaResponse
+	)
+
+	NewArchiveResource().Schema(context.Background(), resource.SchemaRequest{}, &resourceResp)
+	NewArchiveEphemeralResource().Schema(context.Background(), ephemeral.SchemaRequest{}, &ephemeralResp)
+
+	for _, name := range []string{"owner", "group", "uid", "gid", "numeric_owner"} {
+		assert.Equal(t, resourceResp.Schema.Attributes[name].GetDescription(),
+			ephemeralResp.Schema.Attributes[name].GetDescription(), name)
+	}
+
+	for _, block := range []string{"file", "dir", "content"} {
+		t.Run(block, func(t *testing.T) {
+			resourceBlock, ok := resourceResp.Schema.Blocks[block].(schema.SetNestedBlock)
+
+			require.True(t, ok)
+
+			ephemeralBlock, ok := ephemeralResp.Schema.Blocks[block].(ephemeralschema.SetNestedBlock)
+
+			require.True(t, ok)
+
+			assert.Equal(t, resourceBlock.Description, ephemeralBlock.Description)
+
+			resourceAttributes := resourceBlock.NestedObject.Attributes
+			ephemeralAttributes := ephemeralBlock.NestedObject.Attributes
+
+			require.Len(t, ephemeralAttributes, len(resourceAttributes))
+
+			for name, attribute := range resourceAttributes {
+				require.Contains(t, ephemeralAttributes, name)
+
+				assert.Equal(t, attribute.GetDescription(), ephemeralAttributes[name].GetDescription(), name)
+				assert.Equal(t, attribute.GetDeprecationMessage(),
+					ephemeralAttributes[name].GetDeprecationMessage(), name)
+				assert.Equal(t, attribute.IsRequired(), ephemeralAttributes[name].IsRequired(), name)
+			}
+		})
+	}
+}
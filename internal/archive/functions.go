@@ -0,0 +1,200 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+var (
+	_ function.Function = &dirHashFunction{}
+	_ function.Function = &listEntriesFunction{}
+	_ function.Function = &entryContentFunction{}
+)
+
+type dirHashFunction struct{}
+
+func NewDirHashFunction() function.Function {
+	return &dirHashFunction{}
+}
+
+func (f *dirHashFunction) Metadata(_ context.Context,
+	_ function.MetadataRequest, resp *function.MetadataResponse,
+) {
+	resp.Name = "dir_hash"
+}
+
+func (f *dirHashFunction) Definition(_ context.Context,
+	_ function.DefinitionRequest, resp *function.DefinitionResponse,
+) {
+	resp.Definition = function.Definition{
+		Summary: "Hash the files of a directory",
+		Description: "Returns the sha256 of the paths and contents of the regular files under path, " +
+			"it only changes when a file is added, removed, renamed or modified, " +
+			"symbolic links which can not be resolved are hashed by their target",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "path",
+				Description: "directory path",
+			},
+		},
+		VariadicParameter: function.StringParameter{
+			Name:        "excludes",
+			Description: "glob patterns, relative to path, of the files and directories to skip",
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *dirHashFunction) Run(ctx context.Context,
+	req function.RunRequest, resp *function.RunResponse,
+) {
+	var (
+		dir      string
+		excludes []string
+	)
+
+	resp.Error = req.Arguments.Get(ctx, &dir, &excludes)
+	if resp.Error != nil {
+		return
+	}
+
+	for i, p := range excludes {
+		if err := ValidatePattern(p); err != nil {
+			resp.Error = function.NewArgumentFuncError(int64(1+i),
+				fmt.Sprintf("invalid exclude %d: %s", i, err))
+
+			return
+		}
+	}
+
+	hash, err := DirHash(ctx, dir, excludes)
+	if err != nil {
+		resp.Error = function.NewFuncError(err.Error())
+
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, hash)
+}
+
+type listEntriesFunction struct{}
+
+func NewListEntriesFunction() function.Function {
+	return &listEntriesFunction{}
+}
+
+func (f *listEntriesFunction) Metadata(_ context.Context,
+	_ function.MetadataRequest, resp *function.MetadataResponse,
+) {
+	resp.Name = "list_entries"
+}
+
+func (f *listEntriesFunction) Definition(_ context.Context,
+	_ function.DefinitionRequest, resp *function.DefinitionResponse,
+) {
+	resp.Definition = function.Definition{
+		Summary: "List the entries of an archive",
+		Description: "Returns the path, size, octal mode and sha256 of the regular files " +
+			"of a zip, tar, tar.gz or tar.bz2 archive, in archive order",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "archive",
+				Description: "archive path",
+			},
+		},
+		Return: function.ListReturn{
+			ElementType: types.ObjectType{AttrTypes: archivedEntryAttrTypes},
+		},
+	}
+}
+
+func (f *listEntriesFunction) Run(ctx context.Context,
+	req function.RunRequest, resp *function.RunResponse,
+) {
+	var archive string
+
+	resp.Error = req.Arguments.Get(ctx, &archive)
+	if resp.Error != nil {
+		return
+	}
+
+	entries, err := ListEntries(ctx, archive)
+	if err != nil {
+		resp.Error = function.NewFuncError(err.Error())
+
+		return
+	}
+
+	list, d := entriesValue(ctx, entries)
+
+	resp.Error = function.FuncErrorFromDiags(ctx, d)
+	if resp.Error != nil {
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, list)
+}
+
+type entryContentFunction struct{}
+
+func NewEntryContentFunction() function.Function {
+	return &entryContentFunction{}
+}
+
+func (f *entryContentFunction) Metadata(_ context.Context,
+	_ function.MetadataRequest, resp *function.MetadataResponse,
+) {
+	resp.Name = "entry_content"
+}
+
+func (f *entryContentFunction) Definition(_ context.Context,
+	_ function.DefinitionRequest, resp *function.DefinitionResponse,
+) {
+	resp.Definition = function.Definition{
+		Summary: "Read a file inside an archive",
+		Description: "Returns the UTF-8 content of the regular file name " +
+			"of a zip, tar, tar.gz or tar.bz2 archive",
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:        "archive",
+				Description: "archive path",
+			},
+			function.StringParameter{
+				Name:        "name",
+				Description: "entry path inside the archive",
+			},
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *entryContentFunction) Run(ctx context.Context,
+	req function.RunRequest, resp *function.RunResponse,
+) {
+	var archive, name string
+
+	resp.Error = req.Arguments.Get(ctx, &archive, &name)
+	if resp.Error != nil {
+		return
+	}
+
+	b, err := ReadEntry(ctx, archive, name)
+	if err != nil {
+		resp.Error = function.NewFuncError(err.Error())
+
+		return
+	}
+
+	if !utf8.Valid(b) {
+		resp.Error = function.NewArgumentFuncError(1,
+			fmt.Sprintf("%s is not UTF-8 text", name))
+
+		return
+	}
+
+	resp.Error = resp.Result.Set(ctx, string(b))
+}
@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// number of entries listed by size diagnostics.
+const largestEntriesCount = 5
+
+// largestEntries returns the n biggest entries, largest first.
+func largestEntries(entries []Entry, n int) []Entry {
+	sorted := slices.Clone(entries)
+
+	slices.SortStableFunc(sorted, func(a, b Entry) int {
+		return cmp.Compare(b.Size, a.Size)
+	})
+
+	return sorted[:min(n, len(sorted))]
+}
+
+// DescribeLargestEntries lists the biggest entries, one per line
+// to point at what to exclude when a size limit is exceeded.
+func DescribeLargestEntries(entries []Entry) string {
+	out := new(strings.Builder)
+
+	for _, e := range largestEntries(entries, largestEntriesCount) {
+		fmt.Fprintf(out, "  %s: %s\n", e.Path, FormatSize(e.Size))
+	}
+
+	return out.String()
+}
+
+// EntriesOver returns the entries bigger than limit.
+func EntriesOver(entries []Entry, limit int64) []Entry {
+	over := make([]Entry, 0)
+
+	for _, e := range entries {
+		if e.Size > limit {
+			over = append(over, e)
+		}
+	}
+
+	return over
+}
+
+// TotalSize returns the sum of the sizes of entries.
+func TotalSize(entries []Entry) int64 {
+	var total int64
+
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	return total
+}
+
+// FormatSize formats n bytes with a binary unit, e.g. 1.5 MiB.
+func FormatSize(n int64) string {
+	const unit = 1 << 10
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+
+	for m := n / unit; m >= unit && exp < 2; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMG"[exp])
+}
+
+// InputEntries returns the uncompressed size of every file found in files
+// and dirs, excluded paths are skipped, missing paths are ignored since
+// they are reported when the archive is written.
+func InputEntries(ctx context.Context, excludeList, files, dirs []string) ([]Entry, error) {
+	excludes, err := resolveExcludeList(excludeList)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(files))
+
+	for _, f := range files {
+		if slices.Contains(excludes, f) {
+			continue
+		}
+
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, Entry{Path: f, Size: info.Size(), Mode: info.Mode().Perm()})
+	}
+
+	for _, d := range dirs {
+		err := filepath.WalkDir(d, func(p string, entry fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if slices.Contains(excludes, p) {
+				if entry != nil && entry.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+
+			entries = append(entries, Entry{Path: p, Size: info.Size(), Mode: info.Mode().Perm()})
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error InputEntries: walk %s: %w", d, err)
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,59 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSize(t *testing.T) {
+	for n, expected := range map[int64]string{
+		512:             "512 B",
+		1536:            "1.5 KiB",
+		50 << 20:        "50.0 MiB",
+		3 << 30:         "3.0 GiB",
+		(1 << 40) + 100: "1024.0 GiB",
+	} {
+		assert.Equal(t, expected, FormatSize(n))
+	}
+}
+
+func TestLargestEntries(t *testing.T) {
+	entries := []Entry{
+		{Path: "a", Size: 1},
+		{Path: "b", Size: 30},
+		{Path: "c", Size: 20},
+	}
+
+	assert.Equal(t, []Entry{{Path: "b", Size: 30}, {Path: "c", Size: 20}}, largestEntries(entries, 2))
+	assert.Equal(t, []Entry{{Path: "b", Size: 30}}, EntriesOver(entries, 20))
+	assert.Equal(t, int64(51), TotalSize(entries))
+	assert.Equal(t, "  b: 30 B\n  c: 20 B\n  a: 1 B\n", DescribeLargestEntries(entries))
+}
+
+func TestInputEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "src", "vendor"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "src", "main.go"), make([]byte, 10), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "src", "vendor", "big.bin"), make([]byte, 100), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "README.md"), make([]byte, 5), 0o644))
+
+	entries, err := InputEntries(context.Background(),
+		[]string{filepath.Join(dir, "src", "vendor")},
+		[]string{filepath.Join(dir, "README.md"), filepath.Join(dir, "missing")},
+		[]string{filepath.Join(dir, "src")})
+
+	require.Nil(t, err)
+
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, filepath.Join(dir, "README.md"), entries[0].Path)
+	assert.Equal(t, int64(5), entries[0].Size)
+	assert.Equal(t, filepath.Join(dir, "src", "main.go"), entries[1].Path)
+	assert.Equal(t, int64(10), entries[1].Size)
+}
@@ -0,0 +1,171 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// LinkSettings selects the files ArchiveDir writes as tar hard links
+// to an entry written before them.
+type LinkSettings struct {
+	// also link files sharing their content, mode, owner and
+	// extended attributes with an earlier file, not only their inode
+	Dedupe bool
+}
+
+// fileID identifies a file by its device and inode.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// linkMeta is what a tar hard link shares with its target
+// on extraction besides its content.
+type linkMeta struct {
+	mode   int64
+	uid    int
+	gid    int
+	uname  string
+	gname  string
+	xattrs string
+}
+
+type inodeKey struct {
+	id   fileID
+	meta linkMeta
+}
+
+type contentKey struct {
+	sha256 string
+	meta   linkMeta
+}
+
+// linkIndex maps the files already written to the tarball
+// to their entry, a nil linkIndex writes no hard link.
+type linkIndex struct {
+	dedupe   bool
+	inodes   map[inodeKey]Entry
+	contents map[contentKey]Entry
+	// sizes of the indexed contents, streamed files are only
+	// hashed ahead of being written if an earlier file has their size.
+	sizes map[int64]bool
+}
+
+func newLinkIndex(settings *LinkSettings) *linkIndex {
+	if settings == nil {
+		return nil
+	}
+
+	return &linkIndex{
+		dedupe:   settings.Dedupe,
+		inodes:   make(map[inodeKey]Entry),
+		contents: make(map[contentKey]Entry),
+		sizes:    make(map[int64]bool),
+	}
+}
+
+func newLinkMeta(header *tar.Header) linkMeta {
+	return linkMeta{
+		mode:   header.Mode,
+		uid:    header.Uid,
+		gid:    header.Gid,
+		uname:  header.Uname,
+		gname:  header.Gname,
+		xattrs: joinRecords(header.PAXRecords),
+	}
+}
+
+// hashAhead reports whether the streamed entry b may share
+// the content of an earlier file and has to be hashed to know it.
+func (l *linkIndex) hashAhead(b *bufferedTarEntry) bool {
+	return l != nil && l.dedupe && l.sizes[b.header.Size]
+}
+
+// target returns the entry b can be written as a hard link to, sum is
+// the hex sha256 of the content of b, empty if it was not hashed.
+func (l *linkIndex) target(b *bufferedTarEntry, sum string) (Entry, bool) {
+	if l == nil {
+		return Entry{}, false
+	}
+
+	meta := newLinkMeta(b.header)
+
+	if b.id != nil {
+		if e, ok := l.inodes[inodeKey{id: *b.id, meta: meta}]; ok {
+			return e, true
+		}
+	}
+
+	if l.dedupe && sum != "" {
+		e, ok := l.contents[contentKey{sha256: sum, meta: meta}]
+
+		return e, ok
+	}
+
+	return Entry{}, false
+}
+
+// add registers e as the target of the next entries sharing the inode
+// or the content of b, and their metadata, the first target is kept.
+func (l *linkIndex) add(b *bufferedTarEntry, e Entry) {
+	if l == nil {
+		return
+	}
+
+	meta := newLinkMeta(b.header)
+
+	if b.id != nil {
+		if key := (inodeKey{id: *b.id, meta: meta}); !hasKey(l.inodes, key) {
+			l.inodes[key] = e
+		}
+	}
+
+	// sparse entries written without hashes are only linked by inode.
+	if key := (contentKey{sha256: e.SHA256, meta: meta}); l.dedupe && e.SHA256 != "" && !hasKey(l.contents, key) {
+		l.contents[key] = e
+		l.sizes[e.Size] = true
+	}
+}
+
+func hasKey[K comparable](m map[K]Entry, key K) bool {
+	_, ok := m[key]
+
+	return ok
+}
+
+// joinRecords returns the PAX records sorted by key in a single string.
+func joinRecords(records map[string]string) string {
+	var sb strings.Builder
+
+	for _, k := range slices.Sorted(maps.Keys(records)) {
+		sb.WriteString(k + "=" + records[k] + "\x00")
+	}
+
+	return sb.String()
+}
+
+// writeLink writes header as a hard link to the entry target,
+// the link is listed in Entries with the content of its target.
+func (t *TarArchiver) writeLink(header *tar.Header, target Entry) error {
+	header.Typeflag = tar.TypeLink
+	header.Linkname = target.Path
+	header.Size = 0
+	// extended attributes belong to the inode, already stored by target.
+	header.PAXRecords = nil
+
+	if err := t.tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writeLink: write header %s: %w", header.Name, err)
+	}
+
+	t.entries = append(t.entries, Entry{
+		Path:   header.Name,
+		Size:   target.Size,
+		Mode:   target.Mode,
+		SHA256: target.SHA256,
+	})
+
+	return nil
+}
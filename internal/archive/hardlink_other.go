@@ -0,0 +1,10 @@
+//go:build !unix
+
+package archive
+
+import "os"
+
+// linkedFileID returns nil, inodes are only compared on unix systems.
+func linkedFileID(_ os.FileInfo) *fileID {
+	return nil
+}
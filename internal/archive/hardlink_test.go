@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarArchiver_HardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are only compared on unix systems")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+
+	require.Nil(t, os.MkdirAll(src, 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("linked"), 0o644))
+	require.Nil(t, os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "c.txt"), []byte("linked"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "d.txt"), []byte("linked"), 0o600))
+
+	tests := []struct {
+		name     string
+		opts     []Options
+		expected map[string]string
+	}{
+		{
+			name:     "none",
+			expected: map[string]string{},
+		},
+		{
+			name:     "inodes",
+			opts:     []Options{WithHardLinks(false)},
+			expected: map[string]string{"src/b.txt": "src/a.txt"},
+		},
+		{
+			name:     "dedupe",
+			opts:     []Options{WithHardLinks(true)},
+			expected: map[string]string{"src/b.txt": "src/a.txt", "src/c.txt": "src/a.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name+".tar.gz")
+
+			a := GetArchiver("tar.gz")
+
+			require.Nil(t, a.Open(context.Background(), name, tt.opts...))
+
+			err := errors.Join(a.ArchiveDir(context.Background(), src, "src"),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			entries := a.Entries()
+
+			require.Len(t, entries, 4)
+
+			for _, e := range entries {
+				assert.Equal(t, entries[0].SHA256, e.SHA256, e.Path)
+			}
+
+			f, err := os.Open(name)
+
+			require.Nil(t, err)
+
+			defer f.Close()
+
+			gr, err := gzip.NewReader(f)
+
+			require.Nil(t, err)
+
+			r := tar.NewReader(gr)
+
+			links := make(map[string]string)
+
+			for {
+				h, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				require.Nil(t, err)
+
+				if h.Typeflag == tar.TypeLink {
+					links[h.Name] = h.Linkname
+
+					assert.Zero(t, h.Size, h.Name)
+				}
+			}
+
+			assert.Equal(t, tt.expected, links)
+		})
+	}
+}
+
+func TestTarArchiver_HardLinksMetadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are only compared on unix systems")
+	}
+
+	dir := t.TempDir()
+
+	for _, sub := range []string{"alpha", "bravo"} {
+		require.Nil(t, os.MkdirAll(filepath.Join(dir, sub), 0o755))
+	}
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "alpha", "config"), []byte("config"), 0o644))
+	require.Nil(t, os.Link(filepath.Join(dir, "alpha", "config"), filepath.Join(dir, "bravo", "config")))
+
+	// files bigger than maxBufferedEntrySize are streamed.
+	big := bytes.Repeat([]byte("big"), maxBufferedEntrySize)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "alpha", "big"), big, 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "bravo", "big"), big, 0o644))
+
+	tests := []struct {
+		name     string
+		owner    *OwnerSettings
+		expected map[string]string
+	}{
+		{
+			name:  "same owner",
+			owner: &OwnerSettings{UID: 0, GID: 0},
+			expected: map[string]string{
+				"bravo/big":    "alpha/big",
+				"bravo/config": "alpha/config",
+			},
+		},
+		{
+			name:     "other owner",
+			owner:    &OwnerSettings{UID: 1000, GID: 1000},
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "links.tar.gz")
+
+			a := GetArchiver("tar.gz")
+
+			require.Nil(t, a.Open(context.Background(), name,
+				WithHardLinks(true), WithOwner(&OwnerSettings{UID: 0, GID: 0})))
+
+			s, ok := a.(EntryOwnerSetter)
+
+			require.True(t, ok)
+
+			err := a.ArchiveDir(context.Background(), filepath.Join(dir, "alpha"), "alpha")
+
+			require.Nil(t, err)
+
+			s.SetEntryOwner(tt.owner)
+
+			err = errors.Join(a.ArchiveDir(context.Background(), filepath.Join(dir, "bravo"), "bravo"),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			assert.Equal(t, tt.expected, readLinks(t, name))
+		})
+	}
+}
+
+func readLinks(t *testing.T, name string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(name)
+
+	require.Nil(t, err)
+
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+
+	require.Nil(t, err)
+
+	r := tar.NewReader(gr)
+
+	links := make(map[string]string)
+
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.Nil(t, err)
+
+		if h.Typeflag == tar.TypeLink {
+			links[h.Name] = h.Linkname
+		}
+	}
+
+	return links
+}
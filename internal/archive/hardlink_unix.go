@@ -0,0 +1,20 @@
+//go:build unix
+
+package archive
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkedFileID returns the device and inode of info,
+// nil if no other path links to the same inode.
+func linkedFileID(info os.FileInfo) *fileID {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return nil
+	}
+
+	// Dev and Ino are not uint64 on every unix system.
+	return &fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)} //nolint:unconvert
+}
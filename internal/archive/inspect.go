@@ -0,0 +1,175 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errEntryFound stops the walk of a source archive once the entry is read.
+var errEntryFound = errors.New("entry found")
+
+// DirHash returns the sha256 of the sha256sum formatted listing of the regular
+// files under dir, in lexical order and relative to dir, so it only changes
+// when a file is added, removed, renamed or modified. files and directories
+// matching one of the excludes path.Match patterns are skipped, symbolic links
+// which can not be resolved are listed with their target.
+func DirHash(ctx context.Context, dir string, excludes []string) (string, error) {
+	filter := &SourceFilter{Exclude: excludes}
+	listing := sha256.New()
+
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if rel == "." {
+			return nil
+		}
+
+		if !filter.match(rel) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		info, err := os.Stat(p)
+		if err != nil && entry.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(listing, "%s -> %s\n", rel, target)
+
+			return nil
+		}
+
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		sum, err := fileSHA256(ctx, p)
+		if err != nil {
+			return err
+		}
+
+		listing.Write([]byte(checksumLine(sum, rel)))
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error DirHash: walk %s: %w", dir, err)
+	}
+
+	return fmt.Sprintf("%x", listing.Sum(nil)), nil
+}
+
+func fileSHA256(ctx context.Context, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	sum := sha256.New()
+
+	if _, err := copyWithContext(ctx, sum, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sum.Sum(nil)), nil
+}
+
+// ListEntries returns the regular files of the zip, tar, tar.gz
+// or tar.bz2 archive, in archive order.
+func ListEntries(ctx context.Context, archive string) ([]Entry, error) {
+	entries := make([]Entry, 0)
+
+	err := walkSourceArchive(ctx, archive, nil, func(e *sourceEntry) error {
+		rc, err := e.open()
+		if err != nil {
+			return fmt.Errorf("open %s: %w", e.name, err)
+		}
+
+		defer rc.Close()
+
+		sum := sha256.New()
+
+		n, err := copyWithContext(ctx, sum, rc)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", e.name, err)
+		}
+
+		entries = append(entries, Entry{
+			Path:   e.name,
+			Size:   n,
+			Mode:   e.mode,
+			SHA256: fmt.Sprintf("%x", sum.Sum(nil)),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error ListEntries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// ReadEntry returns the content of the regular file name
+// of the zip, tar, tar.gz or tar.bz2 archive.
+func ReadEntry(ctx context.Context, archive, name string) ([]byte, error) {
+	var content []byte
+
+	name = strings.TrimPrefix(name, "/")
+
+	err := walkSourceArchive(ctx, archive, nil, func(e *sourceEntry) error {
+		if e.name != name {
+			return nil
+		}
+
+		rc, err := e.open()
+		if err != nil {
+			return fmt.Errorf("open %s: %w", e.name, err)
+		}
+
+		defer rc.Close()
+
+		content, err = io.ReadAll(&contextReader{ctx: ctx, r: rc})
+		if err != nil {
+			return fmt.Errorf("read %s: %w", e.name, err)
+		}
+
+		return errEntryFound
+	})
+
+	switch {
+	case errors.Is(err, errEntryFound):
+		return content, nil
+	case err != nil:
+		return nil, fmt.Errorf("error ReadEntry: %w", err)
+	default:
+		return nil, fmt.Errorf("error ReadEntry: %s not found in %s", name, archive)
+	}
+}
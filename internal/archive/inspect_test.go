@@ -0,0 +1,330 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirHash(t *testing.T) {
+	dir := t.TempDir()
+
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "node_modules"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "main.js"), []byte("main"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "node_modules", "dep.js"), []byte("dep"), 0o644))
+
+	excludes := []string{"node_modules", "*.log"}
+
+	hash, err := DirHash(context.Background(), dir, excludes)
+
+	require.Nil(t, err)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "node_modules", "dep.js"), []byte("dep2"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "debug.log"), []byte("log"), 0o644))
+
+	unchanged, err := DirHash(context.Background(), dir, excludes)
+
+	require.Nil(t, err)
+
+	assert.Equal(t, hash, unchanged)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "main.js"), []byte("main2"), 0o644))
+
+	changed, err := DirHash(context.Background(), dir, excludes)
+
+	require.Nil(t, err)
+
+	assert.NotEqual(t, hash, changed)
+}
+
+func TestDirHash_DanglingLink(t *testing.T) {
+	dir := t.TempDir()
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "main.js"), []byte("main"), 0o644))
+
+	hash, err := DirHash(context.Background(), dir, nil)
+
+	require.Nil(t, err)
+
+	require.Nil(t, os.Symlink("missing.js", filepath.Join(dir, "link.js")))
+
+	dangling, err := DirHash(context.Background(), dir, nil)
+
+	require.Nil(t, err)
+
+	assert.NotEqual(t, hash, dangling)
+
+	require.Nil(t, os.Remove(filepath.Join(dir, "link.js")))
+	require.Nil(t, os.Symlink("other.js", filepath.Join(dir, "link.js")))
+
+	retargeted, err := DirHash(context.Background(), dir, nil)
+
+	require.Nil(t, err)
+
+	assert.NotEqual(t, dangling, retargeted)
+
+	excluded, err := DirHash(context.Background(), dir, []string{"link.js"})
+
+	require.Nil(t, err)
+
+	assert.Equal(t, hash, excluded)
+}
+
+func TestListEntriesAndReadEntry(t *testing.T) {
+	for _, write := range []func(*testing.T, string){writeSourceZip, writeSourceTarGz} {
+		name := filepath.Join(t.TempDir(), "vendor")
+
+		write(t, name)
+
+		entries, err := ListEntries(context.Background(), name)
+
+		require.Nil(t, err)
+
+		require.Len(t, entries, len(sourceEntries))
+
+		for i, e := range sourceEntries {
+			assert.Equal(t, e.name, entries[i].Path)
+			assert.Equal(t, int64(len(e.content)), entries[i].Size)
+
+			b, err := ReadEntry(context.Background(), name, e.name)
+
+			require.Nil(t, err)
+
+			assert.Equal(t, e.content, string(b))
+		}
+
+		_, err = ReadEntry(context.Background(), name, "missing")
+
+		assert.NotNil(t, err)
+	}
+}
+
+func excludesValue(excludes ...string) attr.Value {
+	elemTypes := make([]attr.Type, 0, len(excludes))
+	values := make([]attr.Value, 0, len(excludes))
+
+	for _, e := range excludes {
+		elemTypes = append(elemTypes, types.StringType)
+		values = append(values, types.StringValue(e))
+	}
+
+	return types.TupleValueMust(elemTypes, values)
+}
+
+func TestDirHashFunction(t *testing.T) {
+	dir := t.TempDir()
+
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "node_modules"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "main.js"), []byte("main"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "node_modules", "dep.js"), []byte("dep"), 0o644))
+
+	excluded, err := DirHash(context.Background(), dir, []string{"node_modules"})
+
+	require.Nil(t, err)
+
+	all, err := DirHash(context.Background(), dir, nil)
+
+	require.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		args     []attr.Value
+		expected string
+		err      *function.FuncError
+	}{
+		{
+			name:     "no excludes",
+			args:     []attr.Value{types.StringValue(dir), excludesValue()},
+			expected: all,
+		},
+		{
+			name:     "excludes",
+			args:     []attr.Value{types.StringValue(dir), excludesValue("node_modules", "*.log")},
+			expected: excluded,
+		},
+		{
+			name: "invalid exclude",
+			args: []attr.Value{types.StringValue(dir), excludesValue("*.log", "[")},
+			err: function.NewArgumentFuncError(2,
+				"invalid exclude 1: error ValidatePattern: [: syntax error in pattern"),
+		},
+		{
+			name: "missing dir",
+			args: []attr.Value{types.StringValue(filepath.Join(dir, "missing")), excludesValue()},
+		},
+		{
+			name: "invalid path",
+			args: []attr.Value{types.NumberValue(nil), excludesValue()},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := function.RunResponse{Result: function.NewResultData(types.StringUnknown())}
+
+			NewDirHashFunction().Run(context.Background(), function.RunRequest{
+				Arguments: function.NewArgumentsData(test.args),
+			}, &resp)
+
+			if test.expected != "" {
+				require.Nil(t, resp.Error)
+
+				assert.Equal(t, types.StringValue(test.expected), resp.Result.Value())
+
+				return
+			}
+
+			require.NotNil(t, resp.Error)
+
+			if test.err != nil {
+				assert.Equal(t, test.err, resp.Error)
+			}
+		})
+	}
+}
+
+func TestListEntriesFunction(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "vendor.tar.gz")
+
+	writeSourceTarGz(t, name)
+
+	tests := []struct {
+		name    string
+		args    []attr.Value
+		success bool
+	}{
+		{
+			name:    "archive",
+			args:    []attr.Value{types.StringValue(name)},
+			success: true,
+		},
+		{
+			name: "missing archive",
+			args: []attr.Value{types.StringValue(name + ".missing")},
+		},
+		{
+			name: "invalid archive",
+			args: []attr.Value{types.BoolValue(true)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := function.RunResponse{
+				Result: function.NewResultData(types.ListUnknown(types.ObjectType{AttrTypes: archivedEntryAttrTypes})),
+			}
+
+			NewListEntriesFunction().Run(context.Background(), function.RunRequest{
+				Arguments: function.NewArgumentsData(test.args),
+			}, &resp)
+
+			if !test.success {
+				assert.NotNil(t, resp.Error)
+
+				return
+			}
+
+			require.Nil(t, resp.Error)
+
+			list, ok := resp.Result.Value().(types.List)
+
+			require.True(t, ok)
+
+			var entries []ArchivedEntry
+
+			require.Nil(t, list.ElementsAs(context.Background(), &entries, false))
+			require.Len(t, entries, len(sourceEntries))
+
+			for i, e := range sourceEntries {
+				assert.Equal(t, e.name, entries[i].Path.ValueString())
+				assert.Equal(t, int64(len(e.content)), entries[i].Size.ValueInt64())
+			}
+		})
+	}
+}
+
+func TestEntryContentFunction(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "vendor.zip")
+
+	writeSourceZip(t, name)
+
+	binary := filepath.Join(t.TempDir(), "binary.tar.gz")
+
+	f, err := os.Create(binary)
+
+	require.Nil(t, err)
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	require.Nil(t, tw.WriteHeader(&tar.Header{Name: "blob", Mode: 0o644, Size: 2, Typeflag: tar.TypeReg}))
+
+	_, err = tw.Write([]byte{0xff, 0xfe})
+
+	require.Nil(t, err)
+	require.Nil(t, errors.Join(tw.Close(), gw.Close(), f.Close()))
+
+	tests := []struct {
+		name     string
+		args     []attr.Value
+		expected string
+		err      *function.FuncError
+	}{
+		{
+			name:     "entry",
+			args:     []attr.Value{types.StringValue(name), types.StringValue("bin/tool")},
+			expected: "tool",
+		},
+		{
+			name: "missing entry",
+			args: []attr.Value{types.StringValue(name), types.StringValue("missing")},
+		},
+		{
+			name: "missing archive",
+			args: []attr.Value{types.StringValue(name + ".missing"), types.StringValue("bin/tool")},
+		},
+		{
+			name: "not utf-8",
+			args: []attr.Value{types.StringValue(binary), types.StringValue("blob")},
+			err:  function.NewArgumentFuncError(1, "blob is not UTF-8 text"),
+		},
+		{
+			name: "invalid name",
+			args: []attr.Value{types.StringValue(name), types.Int64Value(1)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := function.RunResponse{Result: function.NewResultData(types.StringUnknown())}
+
+			NewEntryContentFunction().Run(context.Background(), function.RunRequest{
+				Arguments: function.NewArgumentsData(test.args),
+			}, &resp)
+
+			if test.expected != "" {
+				require.Nil(t, resp.Error)
+
+				assert.Equal(t, types.StringValue(test.expected), resp.Result.Value())
+
+				return
+			}
+
+			require.NotNil(t, resp.Error)
+
+			if test.err != nil {
+				assert.Equal(t, test.err, resp.Error)
+			}
+		})
+	}
+}
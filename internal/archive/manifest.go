@@ -0,0 +1,136 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"slices"
+)
+
+const (
+	ManifestFormatJSON      = "json"
+	ManifestFormatSHA256Sum = "sha256sum"
+	DefaultManifestPath     = "MANIFEST.json"
+)
+
+// Entry describes a file written to an archive.
+type Entry struct {
+	Path   string
+	Size   int64
+	Mode   os.FileMode
+	SHA256 string
+}
+
+// ManifestSettings describes the manifest written as the last entry of an archive.
+type ManifestSettings struct {
+	// path of the manifest inside the archive
+	Path string
+	// json or sha256sum
+	Format string
+}
+
+// entryLog accumulates the entries written to an archive
+// and the paths excluded or skipped while writing it.
+type entryLog struct {
+	entries  []Entry
+	excluded int
+	skipped  []Skipped
+}
+
+func (l *entryLog) reset() {
+	l.entries = make([]Entry, 0)
+	l.excluded = 0
+	l.skipped = make([]Skipped, 0)
+}
+
+// Entries returns the entries written so far.
+func (l *entryLog) Entries() []Entry {
+	return l.entries
+}
+
+// record adds an entry whose content was written through sum,
+// a nil sum leaves the SHA256 of the entry empty.
+func (l *entryLog) record(path string, size int64, mode os.FileMode, sum hash.Hash) {
+	e := Entry{
+		Path: path,
+		Size: size,
+		Mode: mode.Perm(),
+	}
+
+	if sum != nil {
+		e.SHA256 = fmt.Sprintf("%x", sum.Sum(nil))
+	}
+
+	l.entries = append(l.entries, e)
+}
+
+// checkManifestPath fails when the manifest path p is the path of a written entry,
+// the archive would hold two different entries of the same path.
+func (l *entryLog) checkManifestPath(p string) error {
+	if slices.ContainsFunc(l.entries, func(e Entry) bool {
+		return path.Clean(e.Path) == path.Clean(p)
+	}) {
+		return fmt.Errorf("error checkManifestPath: %s is an entry of the archive, "+
+			"the manifest needs another path", p)
+	}
+
+	return nil
+}
+
+// recordBytes adds an entry whose content is b.
+func (l *entryLog) recordBytes(path string, mode os.FileMode, b []byte) {
+	sum := sha256.New()
+	sum.Write(b)
+
+	l.record(path, int64(len(b)), mode, sum)
+}
+
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Mode   string `json:"mode"`
+	SHA256 string `json:"sha256"`
+}
+
+type manifestDocument struct {
+	Entries []manifestEntry `json:"entries"`
+}
+
+// buildManifest renders entries either as a json document
+// or in the coreutils sha256sum format.
+func buildManifest(format string, entries []Entry) ([]byte, error) {
+	switch format {
+	case ManifestFormatSHA256Sum:
+		out := new(bytes.Buffer)
+
+		for _, e := range entries {
+			out.WriteString(checksumLine(e.SHA256, e.Path))
+		}
+
+		return out.Bytes(), nil
+	case ManifestFormatJSON, "":
+		m := manifestDocument{Entries: make([]manifestEntry, 0, len(entries))}
+
+		for _, e := range entries {
+			m.Entries = append(m.Entries, manifestEntry{
+				Path:   e.Path,
+				Size:   e.Size,
+				Mode:   fmt.Sprintf("%04o", e.Mode),
+				SHA256: e.SHA256,
+			})
+		}
+
+		b, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error buildManifest: encode json: %w", err)
+		}
+
+		return append(b, '\n'), nil
+	default:
+		return nil, fmt.Errorf("error buildManifest: unsupported format %s", format)
+	}
+}
@@ -0,0 +1,88 @@
+package archive
+
+import (
+	"archive/tar"
+)
+
+// KeepID leaves the uid or gid of an entry unchanged.
+const KeepID = -1
+
+// OwnerSettings overrides the owner of tar entries
+// empty names and KeepID ids keep the owner of the archived file.
+type OwnerSettings struct {
+	Owner string
+	Group string
+	UID   int
+	GID   int
+	// write the ids only, without user and group names
+	NumericOwner bool
+}
+
+// EntryOwnerSetter is implemented by archivers writing the owner of their entries.
+type EntryOwnerSetter interface {
+	// SetEntryOwner overrides the owner of the next entries on top of
+	// the owner of the archive, nil restores the owner of the archive.
+	SetEntryOwner(owner *OwnerSettings)
+}
+
+// merge returns o with the fields set in override replaced.
+func (o *OwnerSettings) merge(override *OwnerSettings) *OwnerSettings {
+	if override == nil {
+		return o
+	}
+
+	merged := OwnerSettings{UID: KeepID, GID: KeepID}
+	if o != nil {
+		merged = *o
+	}
+
+	if override.Owner != "" {
+		merged.Owner = override.Owner
+	}
+
+	if override.Group != "" {
+		merged.Group = override.Group
+	}
+
+	if override.UID != KeepID {
+		merged.UID = override.UID
+	}
+
+	if override.GID != KeepID {
+		merged.GID = override.GID
+	}
+
+	return &merged
+}
+
+// apply sets the owner of header.
+func (o *OwnerSettings) apply(header *tar.Header) {
+	if o == nil {
+		return
+	}
+
+	if o.Owner != "" {
+		header.Uname = o.Owner
+	}
+
+	if o.Group != "" {
+		header.Gname = o.Group
+	}
+
+	// extractors resolve names before ids, an overridden id without
+	// name must not keep the name of the owner of the archived file.
+	if o.UID != KeepID {
+		header.Uid = o.UID
+		header.Uname = o.Owner
+	}
+
+	if o.GID != KeepID {
+		header.Gid = o.GID
+		header.Gname = o.Group
+	}
+
+	if o.NumericOwner {
+		header.Uname = ""
+		header.Gname = ""
+	}
+}
@@ -0,0 +1,148 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// parallelGzipBlockSize is the amount of uncompressed bytes
+// compressed by a single worker of parallelGzipWriter.
+const parallelGzipBlockSize = 1 << 20
+
+type gzipBlock struct {
+	buf  *bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+// parallelGzipWriter compresses fixed size blocks concurrently
+// and writes every block as a gzip member in the order it was written
+// concatenated members form a valid gzip stream (RFC 1952, section 2.2)
+// and the output only depends on the input, not on the number of workers.
+type parallelGzipWriter struct {
+	w      io.Writer
+	buf    []byte
+	queue  chan *gzipBlock
+	doneWr chan struct{}
+	mu     sync.Mutex
+	err    error
+	// at least one block was handed to a worker
+	flushed bool
+}
+
+func newParallelGzipWriter(w io.Writer, workers int) *parallelGzipWriter {
+	p := &parallelGzipWriter{
+		w:      w,
+		buf:    make([]byte, 0, parallelGzipBlockSize),
+		queue:  make(chan *gzipBlock, workers),
+		doneWr: make(chan struct{}),
+	}
+
+	go p.writeBlocks()
+
+	return p
+}
+
+// writeBlocks writes compressed blocks to the underlying writer in order.
+func (p *parallelGzipWriter) writeBlocks() {
+	defer close(p.doneWr)
+
+	for b := range p.queue {
+		<-b.done
+
+		if p.getErr() != nil {
+			continue
+		}
+
+		err := b.err
+		if err == nil {
+			_, err = p.w.Write(b.buf.Bytes())
+		}
+
+		if err != nil {
+			p.setErr(fmt.Errorf("error parallelGzipWriter: write block: %w", err))
+		}
+	}
+}
+
+func (p *parallelGzipWriter) getErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+func (p *parallelGzipWriter) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// flush hands the buffered bytes to a new compression worker.
+func (p *parallelGzipWriter) flush() {
+	block := &gzipBlock{
+		buf:  new(bytes.Buffer),
+		done: make(chan struct{}),
+	}
+
+	data := p.buf
+	p.buf = make([]byte, 0, parallelGzipBlockSize)
+	p.flushed = true
+
+	p.queue <- block
+
+	go func() {
+		defer close(block.done)
+
+		gw := gzip.NewWriter(block.buf)
+
+		if _, err := gw.Write(data); err != nil {
+			block.err = err
+
+			return
+		}
+
+		block.err = gw.Close()
+	}()
+}
+
+func (p *parallelGzipWriter) Write(b []byte) (int, error) {
+	written := 0
+
+	for len(b) > 0 {
+		if err := p.getErr(); err != nil {
+			return written, err
+		}
+
+		n := min(len(b), parallelGzipBlockSize-len(p.buf))
+		p.buf = append(p.buf, b[:n]...)
+		b = b[n:]
+		written += n
+
+		if len(p.buf) == parallelGzipBlockSize {
+			p.flush()
+		}
+	}
+
+	return written, nil
+}
+
+// Close compresses the remaining bytes and waits for all blocks to be written
+// an empty stream still gets one member, so it can be read back
+// it does not close the underlying writer.
+func (p *parallelGzipWriter) Close() error {
+	if len(p.buf) > 0 || !p.flushed {
+		p.flush()
+	}
+
+	close(p.queue)
+	<-p.doneWr
+
+	return p.getErr()
+}
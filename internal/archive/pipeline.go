@@ -0,0 +1,80 @@
+package archive
+
+import (
+	"context"
+	"sync"
+)
+
+// pendingItem is an item handed to a worker,
+// done is closed as soon as res and err are set.
+type pendingItem[T, R any] struct {
+	item T
+	res  R
+	err  error
+	done chan struct{}
+}
+
+// processOrdered calls prepare on up to workers items concurrently
+// and calls write for every item in the order of items
+// prepare errors are handed to write which decides whether to stop
+// the first error returned by write stops the processing and is returned.
+func processOrdered[T, R any](ctx context.Context, workers int, items []T,
+	prepare func(context.Context, T) (R, error),
+	write func(context.Context, T, R, error) error,
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan *pendingItem[T, R], workers)
+
+	var wg sync.WaitGroup
+
+	go func() {
+		defer close(queue)
+
+		for _, item := range items {
+			p := &pendingItem[T, R]{item: item, done: make(chan struct{})}
+
+			select {
+			case queue <- p:
+			case <-ctx.Done():
+				return
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				defer close(p.done)
+
+				p.res, p.err = prepare(ctx, p.item)
+			}()
+		}
+	}()
+
+	var err error
+
+	for p := range queue {
+		<-p.done
+
+		if err != nil {
+			continue
+		}
+
+		if err = write(ctx, p.item, p.res, p.err); err != nil {
+			cancel()
+		}
+	}
+
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
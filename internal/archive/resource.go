@@ -1,22 +1,30 @@
 package archive
 
 import (
+	"archive/tar"
 	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/objectplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/setplanmodifier"
 
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 
@@ -28,6 +36,7 @@ import (
 
 var (
 	_ resource.ResourceWithValidateConfig = &archiveResource{}
+	_ resource.ResourceWithModifyPlan     = &archiveResource{}
 	_ resource.Resource                   = &archiveResource{}
 )
 
@@ -43,7 +52,7 @@ func (a *archiveResource) Metadata(_ context.Context,
 	resp.TypeName = req.ProviderTypeName + "_file"
 }
 
-func (a *archiveResource) Schema(_ context.Context,
+func (a *archiveResource) Schema(ctx context.Context,
 	_ resource.SchemaRequest, resp *resource.SchemaResponse,
 ) {
 	resp.Schema = schema.Schema{
@@ -79,10 +88,254 @@ func (a *archiveResource) Schema(_ context.Context,
 					listplanmodifier.RequiresReplace(),
 				},
 			},
+			"include_empty_dirs": schema.BoolAttribute{
+				Optional:    true,
+				Description: "write an entry for the empty directories of dir blocks: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"directory_entries": schema.BoolAttribute{
+				Optional:    true,
+				Description: "write an entry for every directory of dir blocks before its files: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"dir_mode": schema.StringAttribute{
+				Optional: true,
+				Description: "octal mode of the directory entries written by include_empty_dirs " +
+					"and directory_entries: default is the mode of each directory",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"tar_format": schema.StringAttribute{
+				Optional: true,
+				Description: "header format of the tar entries: ustar, pax or gnu, " +
+					"default is the most compatible format fitting each entry",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"preserve_xattrs": schema.BoolAttribute{
+				Optional: true,
+				Description: "store the extended attributes of the files, e.g. security.capability, " +
+					"as SCHILY.xattr PAX records of the tar entries: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"preserve_acls": schema.BoolAttribute{
+				Optional: true,
+				Description: "store the POSIX ACLs of the files as SCHILY.acl PAX records " +
+					"of the tar entries, restored by tar --acls: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"special_files": schema.StringAttribute{
+				Optional: true,
+				Description: "devices, named pipes and sockets policy: skip, the default, lists them " +
+					"in skipped, write writes the headers of devices and named pipes in tar archives",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"sparse_files": schema.BoolAttribute{
+				Optional: true,
+				Description: "write only the data of files with holes, e.g. disk images, " +
+					"as PAX sparse tar entries, files of dir blocks up to 8MiB are read in full: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"sparse_hashes": schema.BoolAttribute{
+				Optional: true,
+				Description: "compute the sha256 of the sparse entries in entries, which hashes every byte " +
+					"of their holes, false leaves it empty and can not be used with manifest: default is true",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"hard_links": schema.BoolAttribute{
+				Optional: true,
+				Description: "write the files of dir blocks sharing an inode, mode and owner with an earlier file " +
+					"as tar hard links to it: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"dedupe_files": schema.BoolAttribute{
+				Optional: true,
+				Description: "also write the files of dir blocks sharing their content, mode and owner " +
+					"with an earlier file as tar hard links to it, files bigger than 8MiB are read twice " +
+					"when an earlier file has their size: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"concurrency": schema.Int64Attribute{
+				Optional: true,
+				Description: "number of files read and compressed in parallel: " +
+					"default is the number of CPUs",
+			},
+			"encrypt_to": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "age X25519 recipients (age1...) the whole tar archive is encrypted to",
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
+			"encrypt_passphrase": schema.StringAttribute{
+				Optional:    true,
+				Sensitive:   true,
+				Description: "age passphrase the whole tar archive is encrypted with",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"plaintext_md5": schema.StringAttribute{
+				Computed:    true,
+				Description: "MD5 of the archive before age encryption",
+			},
+			"plaintext_sha256": schema.StringAttribute{
+				Computed:    true,
+				Description: "SHA256 of the archive before age encryption",
+			},
+			"split_size": schema.StringAttribute{
+				Optional: true,
+				Description: "split the archive into <name>.001, <name>.002... volumes of at most " +
+					"this size, e.g. 100MiB, joined back with cat, zip's native split format (.z01) " +
+					"is not supported, the checksum files list the volumes while md5, sha256 and " +
+					"the signature describe the joined archive, the volumes numbered after the last " +
+					"one left by a previous split are removed",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"max_size": schema.StringAttribute{
+				Optional: true,
+				Description: "fail when the archive is bigger than this size, e.g. 50MB, " +
+					"the plan warns when the uncompressed inputs already exceed it",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"max_entry_size": schema.StringAttribute{
+				Optional:    true,
+				Description: "fail when an uncompressed entry is bigger than this size, e.g. 10MiB",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"include_base64": schema.BoolAttribute{
+				Optional:    true,
+				Description: "set output_base64 to the base64 encoded archive: default is false",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.RequiresReplace(),
+				},
+			},
+			"base64_max_size": schema.StringAttribute{
+				Optional: true,
+				Description: "fail when include_base64 is set and the archive is bigger than this size: " +
+					"default is " + DefaultBase64MaxSize,
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"output_base64": schema.StringAttribute{
+				Computed:    true,
+				Sensitive:   true,
+				Description: "Base64 encoded archive if include_base64 is set",
+			},
+			"parts": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "Volumes of the split archive",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"path": schema.StringAttribute{
+							Computed:    true,
+							Description: "Volume absolute path",
+						},
+						"size": schema.Int64Attribute{
+							Computed:    true,
+							Description: "Volume size",
+						},
+						"md5": schema.StringAttribute{
+							Computed:    true,
+							Description: "Volume MD5",
+						},
+						"sha256": schema.StringAttribute{
+							Computed:    true,
+							Description: "Volume SHA256",
+						},
+					},
+				},
+			},
 			"size": schema.Int64Attribute{
 				Computed:    true,
 				Description: "Output file size",
 			},
+			"entry_count": schema.Int64Attribute{
+				Computed: true,
+				Description: "Number of files and hard links written to the archive, the length of entries: " +
+					"directory entries and the manifest are not counted",
+			},
+			"uncompressed_size": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Sum of the uncompressed sizes of the entries",
+			},
+			"compression_ratio": schema.Float64Attribute{
+				Computed:    true,
+				Description: "Uncompressed size divided by the archive size",
+			},
+			"excluded_count": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Number of files and directories skipped by exclude_list",
+			},
+			"entries": schema.ListNestedAttribute{
+				Computed: true,
+				Description: "Files and hard links written to the archive, in archive order, " +
+					"without directory entries nor the manifest",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"path": schema.StringAttribute{
+							Computed:    true,
+							Description: "Entry path inside the archive",
+						},
+						"size": schema.Int64Attribute{
+							Computed:    true,
+							Description: "Entry uncompressed size",
+						},
+						"mode": schema.StringAttribute{
+							Computed:    true,
+							Description: "Entry octal mode",
+						},
+						"sha256": schema.StringAttribute{
+							Computed:    true,
+							Description: "Entry content SHA256",
+						},
+					},
+				},
+			},
+			"skipped": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "Paths which could not be added to the archive",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"path": schema.StringAttribute{
+							Computed:    true,
+							Description: "Skipped path",
+						},
+						"reason": schema.StringAttribute{
+							Computed:    true,
+							Description: "Error which caused the path to be skipped",
+						},
+					},
+				},
+			},
 			"md5": schema.StringAttribute{
 				Computed:    true,
 				Description: "Output file computed MD5",
@@ -95,15 +348,55 @@ func (a *archiveResource) Schema(_ context.Context,
 				Computed:    true,
 				Description: "Output archive absolute path",
 			},
+			"signature": schema.StringAttribute{
+				Computed:    true,
+				Description: "Content of the detached signature file",
+			},
+			"public_key_id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Id of the public key verifying the signature",
+			},
+			"signature_path": schema.StringAttribute{
+				Computed:    true,
+				Description: "Detached signature absolute path",
+			},
+			"checksum_file_paths": schema.ListAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Absolute paths of the written checksum files",
+			},
+			"checksum_manifest_path": schema.StringAttribute{
+				Computed:    true,
+				Description: "Absolute path of the shared checksum manifest",
+			},
 		},
 		Blocks: map[string]schema.Block{
-			"file": schema.SetNestedBlock{
-				Description: "file to include in the archive",
+			"nested": schema.SetNestedBlock{
+				Description: "archive built from its own files, dirs and contents " +
+					"and included as a single entry of the archive",
 				NestedObject: schema.NestedBlockObject{
 					Attributes: map[string]schema.Attribute{
-						"path": schema.StringAttribute{
+						"file_path": schema.StringAttribute{
+							Required:    true,
+							Description: "path of the nested archive inside the archive",
+						},
+						"type": schema.StringAttribute{
 							Required:    true,
-							Description: "file path",
+							Description: "nested archive type: zip or tar.gz",
+						},
+					},
+					Blocks: map[string]schema.Block{
+						"file": schema.SetNestedBlock{
+							Description:  "file to include in the nested archive",
+							NestedObject: resourceBlockObject(inputBlocks["file"].attributes),
+						},
+						"dir": schema.SetNestedBlock{
+							Description:  "directory to include in the nested archive",
+							NestedObject: resourceBlockObject(inputBlocks["dir"].attributes),
+						},
+						"content": schema.SetNestedBlock{
+							Description:  "text or base64 content to include in the nested archive",
+							NestedObject: resourceBlockObject(inputBlocks["content"].attributes),
 						},
 					},
 				},
@@ -111,13 +404,27 @@ func (a *archiveResource) Schema(_ context.Context,
 					setplanmodifier.RequiresReplace(),
 				},
 			},
-			"dir": schema.SetNestedBlock{
-				Description: "directory to include in the archive",
+			"template": schema.SetNestedBlock{
+				Description: "go text/template file rendered with vars at apply time " +
+					"and included in the archive",
 				NestedObject: schema.NestedBlockObject{
 					Attributes: map[string]schema.Attribute{
-						"path": schema.StringAttribute{
+						"source": schema.StringAttribute{
+							Required:    true,
+							Description: "template file path",
+						},
+						"vars": schema.MapAttribute{
+							Optional:    true,
+							ElementType: types.StringType,
+							Description: "variables referenced as {{ .name }} in the template",
+						},
+						"file_path": schema.StringAttribute{
 							Required:    true,
-							Description: "directory path",
+							Description: "file containing the rendered template",
+						},
+						"mode": schema.StringAttribute{
+							Optional:    true,
+							Description: "rendered file mode: default is 666",
 						},
 					},
 				},
@@ -125,17 +432,30 @@ func (a *archiveResource) Schema(_ context.Context,
 					setplanmodifier.RequiresReplace(),
 				},
 			},
-			"content": schema.SetNestedBlock{
-				Description: "base64 content to include in the archive",
+			"source_archive": schema.SetNestedBlock{
+				Description: "existing zip, tar, tar.gz or tar.bz2 archive whose regular files " +
+					"are copied into the archive, zip entries are not recompressed, leading / and ../ " +
+					"are stripped from the entry paths",
 				NestedObject: schema.NestedBlockObject{
 					Attributes: map[string]schema.Attribute{
-						"src": schema.StringAttribute{
+						"path": schema.StringAttribute{
 							Required:    true,
-							Description: "base64 encoded bytes",
+							Description: "source archive path",
 						},
-						"file_path": schema.StringAttribute{
-							Required:    true,
-							Description: "file containing the decoded base64 bytes",
+						"include": schema.ListAttribute{
+							Optional:    true,
+							ElementType: types.StringType,
+							Description: "glob patterns of the entries or directories to copy: " +
+								"default is every entry",
+						},
+						"exclude": schema.ListAttribute{
+							Optional:    true,
+							ElementType: types.StringType,
+							Description: "glob patterns of the entries or directories to skip",
+						},
+						"prefix": schema.StringAttribute{
+							Optional:    true,
+							Description: "directory the copied entries are placed under",
 						},
 					},
 				},
@@ -143,8 +463,270 @@ func (a *archiveResource) Schema(_ context.Context,
 					setplanmodifier.RequiresReplace(),
 				},
 			},
+			"signing": schema.SingleNestedBlock{
+				Description: "sign the archive with an ed25519 key, the detached signature " +
+					"is written next to the archive, it signs the joined archive when split_size is set",
+				Attributes: map[string]schema.Attribute{
+					"format": schema.StringAttribute{
+						Optional: true,
+						Description: "signature format: ed25519 (base64 signature in <name>.sig) " +
+							"or minisign (<name>.minisig): default is ed25519, minisign signatures are " +
+							"checked without reading the whole archive in memory",
+					},
+					"private_key": schema.StringAttribute{
+						Optional:  true,
+						Sensitive: true,
+						Description: "PEM encoded PKCS #8 ed25519 private key or unencrypted " +
+							"minisign secret key",
+					},
+					"private_key_file": schema.StringAttribute{
+						Optional:    true,
+						Description: "file containing the private key",
+					},
+				},
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+			},
+			"checksum_file": schema.SingleNestedBlock{
+				Description: "write coreutils formatted checksum files next to the archive, " +
+					"listing its volumes when split_size is set",
+				Attributes: map[string]schema.Attribute{
+					"sha256": schema.BoolAttribute{
+						Optional:    true,
+						Description: "write <name>.sha256: default is false",
+					},
+					"md5": schema.BoolAttribute{
+						Optional:    true,
+						Description: "write <name>.md5: default is false",
+					},
+					"manifest": schema.StringAttribute{
+						Optional: true,
+						Description: "shared manifest (e.g. SHA256SUMS) the sha256 of the archive " +
+							"is added to, the line is removed when the archive is deleted",
+					},
+				},
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+			},
+			"manifest": schema.SingleNestedBlock{
+				Description: "write a manifest listing the path, size, mode and sha256 " +
+					"of every entry as the last entry of the archive",
+				Attributes: map[string]schema.Attribute{
+					"path": schema.StringAttribute{
+						Optional:    true,
+						Description: "manifest path inside the archive, the archive fails when an entry has it: default is MANIFEST.json",
+					},
+					"format": schema.StringAttribute{
+						Optional:    true,
+						Description: "manifest format: json or sha256sum: default is json",
+					},
+				},
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+			},
+			"encryption": schema.SingleNestedBlock{
+				Description: "password protect the entries of a zip archive",
+				Attributes: map[string]schema.Attribute{
+					"method": schema.StringAttribute{
+						Optional: true,
+						Description: "encryption method: aes256 (WinZip AE-2) or zipcrypto: " +
+							"default is aes256",
+					},
+					"password": schema.StringAttribute{
+						Optional:    true,
+						Sensitive:   true,
+						Description: "password protecting the entries",
+					},
+				},
+				PlanModifiers: []planmodifier.Object{
+					objectplanmodifier.RequiresReplace(),
+				},
+			},
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{
+				Create: true,
+				Update: true,
+			}),
 		},
 	}
+
+	for name, a := range ownerAttributes {
+		resp.Schema.Attributes[name] = resourceAttribute(a, true)
+	}
+
+	for name, b := range inputBlocks {
+		resp.Schema.Blocks[name] = schema.SetNestedBlock{
+			Description:  b.description,
+			NestedObject: resourceBlockObject(b.attributes),
+			PlanModifiers: []planmodifier.Set{
+				setplanmodifier.RequiresReplace(),
+			},
+		}
+	}
+}
+
+// sharedAttribute is an attribute the resource and ephemeral resource
+// schemas both declare, each builds it with its own schema package.
+type sharedAttribute struct {
+	attrType    attr.Type
+	required    bool
+	description string
+	deprecation string
+}
+
+// sharedBlock is a set of nested blocks both schemas declare.
+type sharedBlock struct {
+	description string
+	attributes  map[string]sharedAttribute
+}
+
+// ownerAttributes set the owner of the tar entries of the archive.
+var ownerAttributes = map[string]sharedAttribute{
+	"owner": {
+		attrType:    types.StringType,
+		description: "user name of the tar entries: default is the owner of each file",
+	},
+	"group": {
+		attrType:    types.StringType,
+		description: "group name of the tar entries: default is the group of each file",
+	},
+	"uid": {
+		attrType: types.Int64Type,
+		description: "user id of the tar entries, the user name is cleared unless owner is set: " +
+			"default is the uid of each file",
+	},
+	"gid": {
+		attrType: types.Int64Type,
+		description: "group id of the tar entries, the group name is cleared unless group is set: " +
+			"default is the gid of each file",
+	},
+	"numeric_owner": {
+		attrType:    types.BoolType,
+		description: "write the uid and gid of the tar entries without user and group names: default is false",
+	},
+}
+
+// inputBlocks are the file, dir and content blocks of the archive,
+// their owner attributes override the owner of their tar entries.
+var inputBlocks = map[string]sharedBlock{
+	"file": {
+		description: "file to include in the archive",
+		attributes: withBlockOwnerAttributes(map[string]sharedAttribute{
+			"path": {attrType: types.StringType, required: true, description: "file path"},
+		}),
+	},
+	"dir": {
+		description: "directory to include in the archive",
+		attributes: withBlockOwnerAttributes(map[string]sharedAttribute{
+			"path": {attrType: types.StringType, required: true, description: "directory path"},
+		}),
+	},
+	"content": {
+		description: "text or base64 content to include in the archive",
+		attributes: withBlockOwnerAttributes(map[string]sharedAttribute{
+			"src": {
+				attrType:    types.StringType,
+				description: "base64 encoded bytes",
+				deprecation: "use base64 instead",
+			},
+			"text": {
+				attrType:    types.StringType,
+				description: "UTF-8 text, exclusive with base64",
+			},
+			"base64": {
+				attrType:    types.StringType,
+				description: "base64 encoded bytes, exclusive with text",
+			},
+			"file_path": {
+				attrType:    types.StringType,
+				required:    true,
+				description: "file containing the text or the decoded base64 bytes",
+			},
+		}),
+	},
+}
+
+// withBlockOwnerAttributes adds the attributes overriding
+// the owner of the tar entries written from a block.
+func withBlockOwnerAttributes(attributes map[string]sharedAttribute) map[string]sharedAttribute {
+	attributes["owner"] = sharedAttribute{
+		attrType:    types.StringType,
+		description: "user name of the tar entries of the block, overrides owner",
+	}
+	attributes["group"] = sharedAttribute{
+		attrType:    types.StringType,
+		description: "group name of the tar entries of the block, overrides group",
+	}
+	attributes["uid"] = sharedAttribute{
+		attrType:    types.Int64Type,
+		description: "user id of the tar entries of the block, overrides uid",
+	}
+	attributes["gid"] = sharedAttribute{
+		attrType:    types.Int64Type,
+		description: "group id of the tar entries of the block, overrides gid",
+	}
+
+	return attributes
+}
+
+// resourceAttribute builds a as a resource attribute,
+// replace recreates the archive when its value changes.
+func resourceAttribute(a sharedAttribute, replace bool) schema.Attribute {
+	switch a.attrType {
+	case types.Int64Type:
+		attribute := schema.Int64Attribute{
+			Required:           a.required,
+			Optional:           !a.required,
+			Description:        a.description,
+			DeprecationMessage: a.deprecation,
+		}
+
+		if replace {
+			attribute.PlanModifiers = []planmodifier.Int64{int64planmodifier.RequiresReplace()}
+		}
+
+		return attribute
+	case types.BoolType:
+		attribute := schema.BoolAttribute{
+			Required:           a.required,
+			Optional:           !a.required,
+			Description:        a.description,
+			DeprecationMessage: a.deprecation,
+		}
+
+		if replace {
+			attribute.PlanModifiers = []planmodifier.Bool{boolplanmodifier.RequiresReplace()}
+		}
+
+		return attribute
+	default:
+		attribute := schema.StringAttribute{
+			Required:           a.required,
+			Optional:           !a.required,
+			Description:        a.description,
+			DeprecationMessage: a.deprecation,
+		}
+
+		if replace {
+			attribute.PlanModifiers = []planmodifier.String{stringplanmodifier.RequiresReplace()}
+		}
+
+		return attribute
+	}
+}
+
+func resourceBlockObject(attributes map[string]sharedAttribute) schema.NestedBlockObject {
+	object := schema.NestedBlockObject{
+		Attributes: make(map[string]schema.Attribute, len(attributes)),
+	}
+
+	for name, a := range attributes {
+		object.Attributes[name] = resourceAttribute(a, false)
+	}
+
+	return object
 }
 
 func (a *archiveResource) ValidateConfig(ctx context.Context,
@@ -174,302 +756,1794 @@ func (a *archiveResource) ValidateConfig(ctx context.Context,
 			"resolve_symlink is null, the default value false will be used "+
 				"and symlinks will not be resolved")
 	}
-}
 
-func (a *archiveResource) Create(ctx context.Context,
-	req resource.CreateRequest, resp *resource.CreateResponse,
-) {
-	tflog.Debug(ctx, "creating archive....")
-	var plan Model
+	if !plan.Concurrency.IsNull() && !plan.Concurrency.IsUnknown() &&
+		plan.Concurrency.ValueInt64() < 1 {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("concurrency"),
+			"invalid concurrency",
+			fmt.Sprintf("concurrency must be at least 1, got %d",
+				plan.Concurrency.ValueInt64()))
+	}
 
-	d := req.Plan.Get(ctx, &plan)
-	resp.Diagnostics.Append(d...)
+	if plan.Signing != nil {
+		a.validateSigning(plan.Signing, resp)
+	}
 
-	if resp.Diagnostics.HasError() {
-		return
+	if plan.Encryption != nil {
+		a.validateEncryption(plan.Type, plan.Encryption, resp)
 	}
 
-	archiver := GetArchiver(plan.Type.ValueString())
-	if archiver == nil {
-		resp.Diagnostics.AddAttributeError(
-			path.Root("type"),
-			"unsupported archive type",
-			fmt.Sprintf("unsported archive type %s, only zip and tar.gz are supported",
-				plan.Type.ValueString()))
+	a.validateAge(ctx, plan, resp)
 
-		return
-	}
+	a.validateContents(ctx, plan.ContentBlocks, path.Root("content"), &resp.Diagnostics)
 
-	var (
-		mode    = DefaultArchiveMode
-		symLink = false
-		err     error
-	)
+	a.validateNested(ctx, plan, resp)
 
-	if !plan.OutMode.IsNull() {
-		m, err := strconv.ParseInt(plan.OutMode.ValueString(), 8, 32)
+	a.validateTemplates(ctx, plan, resp)
+
+	a.validateSourceArchives(ctx, plan, resp)
+
+	a.validateOwners(ctx, ownerConfig{
+		Type:          plan.Type,
+		NumericOwner:  plan.NumericOwner,
+		EntryOwner:    plan.EntryOwner,
+		FileBlocks:    plan.FileBlocks,
+		DirBlocks:     plan.DirBlocks,
+		ContentBlocks: plan.ContentBlocks,
+	}, &resp.Diagnostics)
+
+	a.validateTarFormat(plan, resp)
+
+	a.validatePAXAttributes(plan, resp)
+
+	if !plan.SpecialFiles.IsNull() && !plan.SpecialFiles.IsUnknown() {
+		write, err := ParseSpecialFiles(plan.SpecialFiles.ValueString())
 		if err != nil {
-			resp.Diagnostics.AddWarning("set archive permission",
-				fmt.Sprintf("can not set archive file perimssions: %s", err))
+			resp.Diagnostics.AddAttributeError(
+				path.Root("special_files"),
+				"invalid special files policy",
+				err.Error())
 		}
 
-		mode = os.FileMode(m)
+		if write && !plan.Type.IsUnknown() && plan.Type.ValueString() == "zip" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("special_files"),
+				"invalid special files policy",
+				"zip archives can not store special files, only skip is supported")
+		}
 	}
 
-	if !plan.ResolveSymLink.IsNull() {
-		symLink = plan.ResolveSymLink.ValueBool()
+	for attribute, links := range map[string]types.Bool{
+		"hard_links":   plan.HardLinks,
+		"dedupe_files": plan.DedupeFiles,
+	} {
+		if links.ValueBool() && !plan.Type.IsUnknown() && plan.Type.ValueString() == "zip" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root(attribute),
+				"unsupported hard links",
+				fmt.Sprintf("%s is only supported for tar archives", attribute))
+		}
 	}
 
-	list := make([]string, 0, len(plan.ExcludeList.Elements()))
+	if !plan.DirMode.IsNull() && !plan.DirMode.IsUnknown() {
+		if _, err := entryMode(plan.DirMode); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("dir_mode"),
+				"invalid mode",
+				err.Error())
+		}
+	}
 
-	resp.Diagnostics.Append(plan.ExcludeList.ElementsAs(ctx, &list, false)...)
+	for attribute, size := range map[string]types.String{
+		"split_size":      plan.SplitSize,
+		"max_size":        plan.MaxSize,
+		"max_entry_size":  plan.MaxEntrySize,
+		"base64_max_size": plan.Base64MaxSize,
+	} {
+		if size.IsNull() || size.IsUnknown() {
+			continue
+		}
+
+		if _, err := ParseSize(size.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root(attribute),
+				"invalid size",
+				err.Error())
+		}
+	}
+
+	if plan.Manifest != nil && !plan.SparseHashes.IsUnknown() && !plan.SparseHashes.IsNull() &&
+		!plan.SparseHashes.ValueBool() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("sparse_hashes"),
+			"invalid sparse hashes",
+			"the manifest lists the sha256 of every entry, sparse_hashes can not be false")
+	}
+
+	if plan.Manifest != nil && !plan.Manifest.Format.IsNull() && !plan.Manifest.Format.IsUnknown() {
+		format := plan.Manifest.Format.ValueString()
+
+		if format != ManifestFormatJSON && format != ManifestFormatSHA256Sum {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("manifest").AtName("format"),
+				"unsupported manifest format",
+				fmt.Sprintf("unsupported manifest format %s, only %s and %s are supported",
+					format, ManifestFormatJSON, ManifestFormatSHA256Sum))
+		}
+	}
+}
+
+// ModifyPlan estimates the archive size from the uncompressed size of its
+// files and dirs when it is created: an entry bigger than max_entry_size is
+// an error, inputs bigger than max_size only a warning since they are compressed.
+// entries not fitting the tar_format headers are warned about as well.
+func (a *archiveResource) ModifyPlan(ctx context.Context,
+	req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse,
+) {
+	if req.Plan.Raw.IsNull() || !req.State.Raw.IsNull() {
+		return
+	}
+
+	var plan Model
+
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	archName, err := filepath.Abs(plan.Name.ValueString())
-	if err != nil {
-		resp.Diagnostics.AddError(
-			"can not resolve path",
-			fmt.Sprintf("can not resolve absolute path %s: %s",
-				plan.Name.ValueString(), err))
+	a.planTarFormat(ctx, plan, resp)
+
+	maxSize, maxSizeErr := ParseSize(plan.MaxSize.ValueString())
+	maxEntrySize, maxEntrySizeErr := ParseSize(plan.MaxEntrySize.ValueString())
 
+	if maxSizeErr != nil && maxEntrySizeErr != nil {
 		return
 	}
 
-	err = archiver.Open(archName,
-		WithFileMode(mode),
-		WithSymLink(symLink),
-		WithExcludeList(list))
+	var (
+		files    = make([]File, 0, len(plan.FileBlocks.Elements()))
+		dirs     = make([]Dir, 0, len(plan.DirBlocks.Elements()))
+		excludes = make([]string, 0, len(plan.ExcludeList.Elements()))
+	)
+
+	d := plan.FileBlocks.ElementsAs(ctx, &files, false)
+	d.Append(plan.DirBlocks.ElementsAs(ctx, &dirs, false)...)
+	d.Append(plan.ExcludeList.ElementsAs(ctx, &excludes, false)...)
+
+	// unknown paths are only known at apply time.
+	if d.HasError() {
+		return
+	}
+
+	filePaths := make([]string, 0, len(files))
+
+	for _, f := range files {
+		if absPath, _, err := a.cleanPath(f.Path.ValueString()); err == nil {
+			filePaths = append(filePaths, absPath)
+		}
+	}
+
+	dirPaths := make([]string, 0, len(dirs))
+
+	for _, dir := range dirs {
+		if absPath, _, err := a.cleanPath(dir.Path.ValueString()); err == nil {
+			dirPaths = append(dirPaths, absPath)
+		}
+	}
+
+	entries, err := InputEntries(ctx, excludes, filePaths, dirPaths)
 	if err != nil {
-		resp.Diagnostics.AddError(
-			fmt.Sprintf("failed to create %s", plan.Name.ValueString()),
-			err.Error())
+		tflog.Warn(ctx, "can not estimate archive size", map[string]interface{}{
+			"err": err,
+		})
 
 		return
 	}
 
-	files := make([]File, 0, len(plan.FileBlocks.Elements()))
-	resp.Diagnostics.Append(plan.FileBlocks.ElementsAs(ctx, &files, false)...)
-	if resp.Diagnostics.HasError() {
-		tflog.Warn(ctx, "failed to add files to archive")
+	if maxEntrySizeErr == nil {
+		if over := EntriesOver(entries, maxEntrySize); len(over) > 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_entry_size"),
+				"entry size limit exceeded",
+				fmt.Sprintf("%d files are bigger than %s:\n%s", len(over),
+					FormatSize(maxEntrySize), DescribeLargestEntries(over)))
+		}
 	}
 
-	a.appendFiles(ctx, archiver, files...)
+	if total := TotalSize(entries); maxSizeErr == nil && total > maxSize {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("max_size"),
+			"archive may exceed its size limit",
+			fmt.Sprintf("the uncompressed files sum up to %s, more than %s, "+
+				"the archive fails unless they compress well, largest files:\n%s",
+				FormatSize(total), FormatSize(maxSize), DescribeLargestEntries(entries)))
+	}
+}
 
-	dirs := make([]Dir, 0, len(plan.DirBlocks.Elements()))
-	resp.Diagnostics.Append(plan.DirBlocks.ElementsAs(ctx, &dirs, false)...)
-	if resp.Diagnostics.HasError() {
-		tflog.Warn(ctx, "failed to add dirs to archive")
+func (a *archiveResource) validateNested(ctx context.Context, plan Model,
+	resp *resource.ValidateConfigResponse,
+) {
+	if plan.NestedBlocks.IsNull() || plan.NestedBlocks.IsUnknown() {
+		return
 	}
 
-	a.appendDirs(ctx, archiver, dirs...)
+	nested := make([]Nested, 0, len(plan.NestedBlocks.Elements()))
 
-	contents := make([]Content, 0, len(plan.ContentBlocks.Elements()))
-	resp.Diagnostics.Append(plan.ContentBlocks.ElementsAs(ctx, &contents, false)...)
+	resp.Diagnostics.Append(plan.NestedBlocks.ElementsAs(ctx, &nested, false)...)
 	if resp.Diagnostics.HasError() {
-		tflog.Warn(ctx, "failed to add contents to archive")
+		return
 	}
 
-	a.appendContents(ctx, archiver, contents...)
+	for _, n := range nested {
+		if !n.Type.IsUnknown() && GetArchiver(n.Type.ValueString()) == nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("nested"),
+				"unsupported archive type",
+				fmt.Sprintf("unsupported archive type %s of %s, only zip and tar.gz are supported",
+					n.Type.ValueString(), n.FilePath.ValueString()))
+		}
 
-	err = archiver.Close()
-	if err != nil {
-		resp.Diagnostics.AddError(
-			fmt.Sprintf("failed to close %s", plan.Name.ValueString()),
-			err.Error())
+		a.validateContents(ctx, n.ContentBlocks, path.Root("nested"), &resp.Diagnostics)
+	}
+}
+
+func (a *archiveResource) validateContents(ctx context.Context, contentBlocks types.Set,
+	p path.Path, diags *diag.Diagnostics,
+) {
+	if contentBlocks.IsNull() || contentBlocks.IsUnknown() {
+		return
+	}
+
+	contents := make([]Content, 0, len(contentBlocks.Elements()))
 
+	diags.Append(contentBlocks.ElementsAs(ctx, &contents, false)...)
+	if diags.HasError() {
 		return
 	}
 
+	for _, c := range contents {
+		set := 0
+
+		for _, v := range []types.String{c.Src, c.Text, c.Base64} {
+			if !v.IsNull() {
+				set++
+			}
+		}
+
+		if set != 1 {
+			diags.AddAttributeError(
+				p,
+				"invalid content",
+				fmt.Sprintf("exactly one of text and base64, or the deprecated src, must be set for %s",
+					c.FilePath.ValueString()))
+
+			continue
+		}
+
+		if _, err := contentBytes(c); err != nil {
+			diags.AddAttributeError(
+				p,
+				"invalid base64 content",
+				err.Error())
+		}
+	}
+}
+
+// ownerConfig is the part of the resource and ephemeral resource
+// configurations setting the owner of the tar entries.
+type ownerConfig struct {
+	Type          types.String
+	NumericOwner  types.Bool
+	EntryOwner    EntryOwner
+	FileBlocks    types.Set
+	DirBlocks     types.Set
+	ContentBlocks types.Set
+}
+
+// validateOwners rejects negative ids and owners set for zip archives
+// which do not store the owner of their entries.
+func (a *archiveResource) validateOwners(ctx context.Context, plan ownerConfig,
+	diags *diag.Diagnostics,
+) {
+	owners := map[string][]EntryOwner{
+		"": {plan.EntryOwner},
+	}
+
 	var (
-		md5    string
-		sha256 string
-		size   int64
+		files    []File
+		dirs     []Dir
+		contents []Content
 	)
 
-	md5, sha256, err = Checksums(archName)
-	if err != nil {
-		resp.Diagnostics.AddWarning("computing md5 and sha2256",
-			fmt.Sprintf("could not compute md5 and sha256 outputs: %s", err))
+	if !plan.FileBlocks.IsUnknown() {
+		diags.Append(plan.FileBlocks.ElementsAs(ctx, &files, false)...)
 	}
 
-	plan.MD5 = types.StringValue(md5)
-	plan.SHA256 = types.StringValue(sha256)
+	if !plan.DirBlocks.IsUnknown() {
+		diags.Append(plan.DirBlocks.ElementsAs(ctx, &dirs, false)...)
+	}
 
-	size, err = Size(archName)
+	if !plan.ContentBlocks.IsUnknown() {
+		diags.Append(plan.ContentBlocks.ElementsAs(ctx, &contents, false)...)
+	}
+
+	if diags.HasError() {
+		return
+	}
+
+	for _, f := range files {
+		owners["file"] = append(owners["file"], f.EntryOwner)
+	}
+
+	for _, d := range dirs {
+		owners["dir"] = append(owners["dir"], d.EntryOwner)
+	}
+
+	for _, c := range contents {
+		owners["content"] = append(owners["content"], c.EntryOwner)
+	}
+
+	zipArchive := !plan.Type.IsUnknown() && plan.Type.ValueString() == "zip"
+
+	for block, blockOwners := range owners {
+		for _, o := range blockOwners {
+			p := path.Root("owner")
+			if block != "" {
+				p = path.Root(block)
+			}
+
+			if zipArchive && ownerSettings(o, plan.NumericOwner.ValueBool() && block == "") != nil {
+				diags.AddAttributeError(
+					p,
+					"unsupported owner",
+					"owner, group, uid, gid and numeric_owner are only supported for tar archives")
+			}
+
+			for attribute, id := range map[string]types.Int64{"uid": o.UID, "gid": o.GID} {
+				if !id.IsNull() && !id.IsUnknown() && id.ValueInt64() < 0 {
+					if block == "" {
+						p = path.Root(attribute)
+					}
+
+					diags.AddAttributeError(
+						p,
+						"invalid id",
+						fmt.Sprintf("%s %d must not be negative", attribute, id.ValueInt64()))
+				}
+			}
+		}
+	}
+}
+
+// validateTarFormat rejects unknown tar formats and tar_format for zip archives.
+func (a *archiveResource) validateTarFormat(plan Model, resp *resource.ValidateConfigResponse) {
+	if plan.TarFormat.IsNull() || plan.TarFormat.IsUnknown() {
+		return
+	}
+
+	if _, err := ParseTarFormat(plan.TarFormat.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("tar_format"),
+			"invalid tar format",
+			err.Error())
+
+		return
+	}
+
+	if !plan.Type.IsUnknown() && plan.Type.ValueString() == "zip" {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("tar_format"),
+			"unsupported tar format",
+			"tar_format is only supported for tar archives")
+	}
+}
+
+// planTarFormat warns about the files, dirs and contents
+// whose path, size or owner do not fit in the tar_format headers.
+func (a *archiveResource) planTarFormat(ctx context.Context, plan Model,
+	resp *resource.ModifyPlanResponse,
+) {
+	if plan.TarFormat.IsNull() || plan.TarFormat.IsUnknown() || plan.Type.ValueString() == "zip" {
+		return
+	}
+
+	// invalid formats are reported by ValidateConfig.
+	format, err := ParseTarFormat(plan.TarFormat.ValueString())
 	if err != nil {
-		resp.Diagnostics.AddWarning("compute file size",
-			fmt.Sprintf("can not compute file size for %s: %s",
-				archName, err))
+		return
 	}
 
-	plan.Size = types.Int64Value(size)
-	plan.AbsPath = types.StringValue(archName)
+	var (
+		files    = make([]File, 0, len(plan.FileBlocks.Elements()))
+		dirs     = make([]Dir, 0, len(plan.DirBlocks.Elements()))
+		contents = make([]Content, 0, len(plan.ContentBlocks.Elements()))
+		excludes = make([]string, 0, len(plan.ExcludeList.Elements()))
+	)
 
-	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+	d := plan.FileBlocks.ElementsAs(ctx, &files, false)
+	d.Append(plan.DirBlocks.ElementsAs(ctx, &dirs, false)...)
+	d.Append(plan.ContentBlocks.ElementsAs(ctx, &contents, false)...)
+	d.Append(plan.ExcludeList.ElementsAs(ctx, &excludes, false)...)
+
+	// unknown paths are only known at apply time.
+	if d.HasError() {
+		return
+	}
+
+	entries := make([]Entry, 0, len(files)+len(contents))
+
+	for _, f := range files {
+		absPath, relPath, err := a.cleanPath(f.Path.ValueString())
+		if err != nil {
+			continue
+		}
+
+		found, err := InputEntries(ctx, excludes, []string{absPath}, nil)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range found {
+			entries = append(entries, Entry{Path: relPath, Size: e.Size, Mode: e.Mode})
+		}
+	}
+
+	for _, dir := range dirs {
+		absPath, relPath, err := a.cleanPath(dir.Path.ValueString())
+		if err != nil {
+			continue
+		}
+
+		found, err := InputEntries(ctx, excludes, nil, []string{absPath})
+		if err != nil {
+			continue
+		}
+
+		for _, e := range found {
+			entries = append(entries, Entry{Path: archivePath(e.Path, relPath), Size: e.Size, Mode: e.Mode})
+		}
+	}
+
+	for _, c := range contents {
+		if b, err := contentBytes(c); err == nil {
+			entries = append(entries, Entry{
+				Path: entryPath(c.FilePath.ValueString()),
+				Size: int64(len(b)),
+				Mode: DefaultContentMode,
+			})
+		}
+	}
+
+	owner := ownerSettings(plan.EntryOwner, plan.NumericOwner.ValueBool())
+
+	if mismatches := TarFormatMismatches(format, owner, entries); len(mismatches) > 0 {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("tar_format"),
+			"entries do not fit the tar format",
+			fmt.Sprintf("%d entries can not be written with the %s format and will be skipped:\n  %s",
+				len(mismatches), plan.TarFormat.ValueString(),
+				strings.Join(mismatches[:min(len(mismatches), largestEntriesCount)], "\n  ")))
+	}
 }
 
-func (a *archiveResource) Read(ctx context.Context,
-	req resource.ReadRequest, resp *resource.ReadResponse,
+// validatePAXAttributes rejects preserve_xattrs, preserve_acls and sparse_files
+// for archives which can not store them: zip archives and non PAX tar archives.
+func (a *archiveResource) validatePAXAttributes(plan Model, resp *resource.ValidateConfigResponse) {
+	for attribute, enabled := range map[string]types.Bool{
+		"preserve_xattrs": plan.PreserveXattrs,
+		"preserve_acls":   plan.PreserveACLs,
+		"sparse_files":    plan.SparseFiles,
+	} {
+		if !enabled.ValueBool() {
+			continue
+		}
+
+		if !plan.Type.IsUnknown() && plan.Type.ValueString() == "zip" {
+			resp.Diagnostics.AddAttributeError(
+				path.Root(attribute),
+				"unsupported attribute",
+				fmt.Sprintf("%s is only supported for tar archives", attribute))
+		}
+
+		if plan.TarFormat.IsNull() || plan.TarFormat.IsUnknown() {
+			continue
+		}
+
+		if format, err := ParseTarFormat(plan.TarFormat.ValueString()); err == nil && format != tar.FormatPAX {
+			resp.Diagnostics.AddAttributeError(
+				path.Root(attribute),
+				"unsupported attribute",
+				fmt.Sprintf("%s is stored in PAX records, tar_format must be pax or unset", attribute))
+		}
+	}
+}
+
+func (a *archiveResource) validateTemplates(ctx context.Context, plan Model,
+	resp *resource.ValidateConfigResponse,
 ) {
-	tflog.Debug(ctx, "refreshing state....")
+	if plan.TemplateBlocks.IsNull() || plan.TemplateBlocks.IsUnknown() {
+		return
+	}
+
+	templates := make([]Template, 0, len(plan.TemplateBlocks.Elements()))
+
+	resp.Diagnostics.Append(plan.TemplateBlocks.ElementsAs(ctx, &templates, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	for _, t := range templates {
+		if t.Mode.IsUnknown() {
+			continue
+		}
+
+		if _, err := entryMode(t.Mode); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("template"),
+				"invalid template mode",
+				fmt.Sprintf("invalid mode of %s: %s", t.FilePath.ValueString(), err))
+		}
+	}
+}
+
+func (a *archiveResource) validateSourceArchives(ctx context.Context, plan Model,
+	resp *resource.ValidateConfigResponse,
+) {
+	if plan.SourceArchives.IsNull() || plan.SourceArchives.IsUnknown() {
+		return
+	}
+
+	sources := make([]SourceArchive, 0, len(plan.SourceArchives.Elements()))
+
+	resp.Diagnostics.Append(plan.SourceArchives.ElementsAs(ctx, &sources, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	for _, s := range sources {
+		for _, list := range []types.List{s.Include, s.Exclude} {
+			if list.IsUnknown() {
+				continue
+			}
+
+			patterns := make([]types.String, 0, len(list.Elements()))
+
+			resp.Diagnostics.Append(list.ElementsAs(ctx, &patterns, false)...)
+
+			for _, p := range patterns {
+				if p.IsNull() || p.IsUnknown() {
+					continue
+				}
+
+				if err := ValidatePattern(p.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(
+						path.Root("source_archive"),
+						"invalid pattern",
+						err.Error())
+				}
+			}
+		}
+	}
+}
+
+func (a *archiveResource) validateAge(ctx context.Context, plan Model,
+	resp *resource.ValidateConfigResponse,
+) {
+	if plan.EncryptTo.IsNull() && plan.Passphrase.IsNull() {
+		return
+	}
+
+	if !plan.Type.IsUnknown() && plan.Type.ValueString() == "zip" {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("encrypt_to"),
+			"unsupported encryption",
+			"age encryption is only supported for tar archives, "+
+				"use the encryption block for zip archives")
+	}
+
+	if !plan.EncryptTo.IsNull() && !plan.Passphrase.IsNull() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("encrypt_passphrase"),
+			"conflicting encryption",
+			"only one of encrypt_to and encrypt_passphrase can be set")
+	}
+
+	if plan.EncryptTo.IsNull() || plan.EncryptTo.IsUnknown() {
+		return
+	}
+
+	recipients := make([]types.String, 0, len(plan.EncryptTo.Elements()))
+
+	resp.Diagnostics.Append(plan.EncryptTo.ElementsAs(ctx, &recipients, false)...)
+
+	for i, r := range recipients {
+		if r.IsUnknown() || r.IsNull() {
+			continue
+		}
+
+		if err := ValidateAgeRecipient(r.ValueString()); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("encrypt_to").AtListIndex(i),
+				"invalid age recipient",
+				err.Error())
+		}
+	}
+}
+
+func (a *archiveResource) validateEncryption(archType types.String, encryption *Encryption,
+	resp *resource.ValidateConfigResponse,
+) {
+	if !archType.IsUnknown() && archType.ValueString() != "zip" {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("encryption"),
+			"unsupported encryption",
+			fmt.Sprintf("encryption is only supported for zip archives, not %s",
+				archType.ValueString()))
+	}
+
+	method := encryption.Method.ValueString()
+
+	if !encryption.Method.IsNull() && !encryption.Method.IsUnknown() &&
+		method != ZipEncryptionAES256 && method != ZipEncryptionZipCrypto {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("encryption").AtName("method"),
+			"unsupported encryption method",
+			fmt.Sprintf("unsupported encryption method %s, only %s and %s are supported",
+				method, ZipEncryptionAES256, ZipEncryptionZipCrypto))
+	}
+
+	if method == ZipEncryptionZipCrypto {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("encryption").AtName("method"),
+			"weak encryption",
+			"zipcrypto is easily broken, only use it for receivers not supporting aes256")
+	}
+
+	if encryption.Password.IsNull() ||
+		(!encryption.Password.IsUnknown() && encryption.Password.ValueString() == "") {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("encryption").AtName("password"),
+			"missing password",
+			"password must be set to encrypt the archive")
+	}
+}
+
+func (a *archiveResource) validateSigning(signing *Signing,
+	resp *resource.ValidateConfigResponse,
+) {
+	format := signing.Format.ValueString()
+
+	if !signing.Format.IsNull() && !signing.Format.IsUnknown() &&
+		format != SignatureFormatEd25519 && format != SignatureFormatMinisign {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("signing").AtName("format"),
+			"unsupported signature format",
+			fmt.Sprintf("unsupported signature format %s, only %s and %s are supported",
+				format, SignatureFormatEd25519, SignatureFormatMinisign))
+	}
+
+	if signing.PrivateKey.IsUnknown() || signing.PrivateKeyFile.IsUnknown() {
+		return
+	}
+
+	if signing.PrivateKey.IsNull() == signing.PrivateKeyFile.IsNull() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("signing"),
+			"invalid signing key",
+			"exactly one of private_key and private_key_file must be set")
+	}
+}
+
+func (a *archiveResource) Create(ctx context.Context,
+	req resource.CreateRequest, resp *resource.CreateResponse,
+) {
+	tflog.Debug(ctx, "creating archive....")
+	var plan Model
+
+	d := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	createTimeout, d := plan.Timeouts.Create(ctx, DefaultCreateTimeout)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	archiver := GetArchiver(plan.Type.ValueString())
+	if archiver == nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("type"),
+			"unsupported archive type",
+			fmt.Sprintf("unsported archive type %s, only zip and tar.gz are supported",
+				plan.Type.ValueString()))
+
+		return
+	}
+
+	var (
+		mode    = DefaultArchiveMode
+		symLink = false
+		workers = runtime.NumCPU()
+		err     error
+	)
+
+	if !plan.OutMode.IsNull() {
+		m, err := strconv.ParseInt(plan.OutMode.ValueString(), 8, 32)
+		if err != nil {
+			resp.Diagnostics.AddWarning("set archive permission",
+				fmt.Sprintf("can not set archive file perimssions: %s", err))
+		}
+
+		mode = os.FileMode(m)
+	}
+
+	if !plan.ResolveSymLink.IsNull() {
+		symLink = plan.ResolveSymLink.ValueBool()
+	}
+
+	if !plan.Concurrency.IsNull() {
+		workers = int(plan.Concurrency.ValueInt64())
+	}
+
+	list := make([]string, 0, len(plan.ExcludeList.Elements()))
+
+	resp.Diagnostics.Append(plan.ExcludeList.ElementsAs(ctx, &list, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	archName, err := filepath.Abs(plan.Name.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"can not resolve path",
+			fmt.Sprintf("can not resolve absolute path %s: %s",
+				plan.Name.ValueString(), err))
+
+		return
+	}
+
+	// nested archives share the settings of their entries with the archive.
+	nestedOpts := []Options{
+		WithSymLink(symLink),
+		WithConcurrency(workers),
+		WithExcludeList(list),
+	}
+
+	if plan.EmptyDirs.ValueBool() || plan.DirEntries.ValueBool() {
+		var dirMode os.FileMode
+
+		if !plan.DirMode.IsNull() {
+			dirMode, err = entryMode(plan.DirMode)
+			if err != nil {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("dir_mode"),
+					"invalid mode",
+					err.Error())
+
+				return
+			}
+		}
+
+		nestedOpts = append(nestedOpts, WithDirEntries(plan.DirEntries.ValueBool(), dirMode))
+	}
+
+	if owner := ownerSettings(plan.EntryOwner, plan.NumericOwner.ValueBool()); owner != nil {
+		nestedOpts = append(nestedOpts, WithOwner(owner))
+	}
+
+	if plan.PreserveXattrs.ValueBool() || plan.PreserveACLs.ValueBool() {
+		nestedOpts = append(nestedOpts, WithXattrs(plan.PreserveXattrs.ValueBool(), plan.PreserveACLs.ValueBool()))
+	}
+
+	if !plan.SpecialFiles.IsNull() {
+		write, err := ParseSpecialFiles(plan.SpecialFiles.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("special_files"),
+				"invalid special files policy",
+				err.Error())
+
+			return
+		}
+
+		nestedOpts = append(nestedOpts, WithSpecialFiles(write))
+	}
+
+	if plan.SparseFiles.ValueBool() {
+		nestedOpts = append(nestedOpts, WithSparse(plan.SparseHashes.IsNull() || plan.SparseHashes.ValueBool()))
+	}
+
+	if plan.HardLinks.ValueBool() || plan.DedupeFiles.ValueBool() {
+		nestedOpts = append(nestedOpts, WithHardLinks(plan.DedupeFiles.ValueBool()))
+	}
+
+	if !plan.TarFormat.IsNull() {
+		format, err := ParseTarFormat(plan.TarFormat.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("tar_format"),
+				"invalid tar format",
+				err.Error())
+
+			return
+		}
+
+		nestedOpts = append(nestedOpts, WithTarFormat(format))
+	}
+
+	opts := append([]Options{WithFileMode(mode)}, nestedOpts...)
+
+	if plan.Manifest != nil {
+		manifestPath := DefaultManifestPath
+		if !plan.Manifest.Path.IsNull() {
+			manifestPath = plan.Manifest.Path.ValueString()
+		}
+
+		opts = append(opts, WithManifest(manifestPath, plan.Manifest.Format.ValueString()))
+	}
+
+	if plan.Encryption != nil {
+		opts = append(opts, WithEncryption(plan.Encryption.Method.ValueString(),
+			plan.Encryption.Password.ValueString()))
+	}
+
+	if !plan.EncryptTo.IsNull() || !plan.Passphrase.IsNull() {
+		recipients := make([]string, 0, len(plan.EncryptTo.Elements()))
+
+		resp.Diagnostics.Append(plan.EncryptTo.ElementsAs(ctx, &recipients, false)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+
+		opts = append(opts, WithAge(recipients, plan.Passphrase.ValueString()))
+	}
+
+	err = archiver.Open(ctx, archName, opts...)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			fmt.Sprintf("failed to create %s", plan.Name.ValueString()),
+			err.Error())
+
+		return
+	}
+
+	files := make([]File, 0, len(plan.FileBlocks.Elements()))
+	resp.Diagnostics.Append(plan.FileBlocks.ElementsAs(ctx, &files, false)...)
+	if resp.Diagnostics.HasError() {
+		tflog.Warn(ctx, "failed to add files to archive")
+	}
+
+	err = a.appendFiles(ctx, archiver, files...)
+
+	dirs := make([]Dir, 0, len(plan.DirBlocks.Elements()))
+	resp.Diagnostics.Append(plan.DirBlocks.ElementsAs(ctx, &dirs, false)...)
+	if resp.Diagnostics.HasError() {
+		tflog.Warn(ctx, "failed to add dirs to archive")
+	}
+
+	if err == nil {
+		err = a.appendDirs(ctx, archiver, dirs...)
+	}
+
+	contents := make([]Content, 0, len(plan.ContentBlocks.Elements()))
+	resp.Diagnostics.Append(plan.ContentBlocks.ElementsAs(ctx, &contents, false)...)
+	if resp.Diagnostics.HasError() {
+		tflog.Warn(ctx, "failed to add contents to archive")
+	}
+
+	if err == nil {
+		err = a.appendContents(ctx, archiver, contents...)
+	}
+
+	templates := make([]Template, 0, len(plan.TemplateBlocks.Elements()))
+	resp.Diagnostics.Append(plan.TemplateBlocks.ElementsAs(ctx, &templates, false)...)
+	if resp.Diagnostics.HasError() {
+		tflog.Warn(ctx, "failed to add templates to archive")
+	}
+
+	if err == nil {
+		err = a.appendTemplates(ctx, archiver, templates...)
+	}
+
+	sources := make([]SourceArchive, 0, len(plan.SourceArchives.Elements()))
+	resp.Diagnostics.Append(plan.SourceArchives.ElementsAs(ctx, &sources, false)...)
+	if resp.Diagnostics.HasError() {
+		tflog.Warn(ctx, "failed to add source archives to archive")
+	}
+
+	if err == nil {
+		err = a.appendSourceArchives(ctx, archiver, sources...)
+	}
+
+	nested := make([]Nested, 0, len(plan.NestedBlocks.Elements()))
+	resp.Diagnostics.Append(plan.NestedBlocks.ElementsAs(ctx, &nested, false)...)
+	if resp.Diagnostics.HasError() {
+		tflog.Warn(ctx, "failed to add nested archives to archive")
+	}
+
+	if err == nil {
+		err = a.appendNested(ctx, archiver, nestedOpts, nested...)
+	}
+
+	if err != nil {
+		resp.Diagnostics.AddError(
+			fmt.Sprintf("failed to create %s", plan.Name.ValueString()),
+			errors.Join(err, discardArchive(ctx, archiver)).Error())
+
+		return
+	}
+
+	if !plan.MaxEntrySize.IsNull() {
+		maxEntrySize, err := ParseSize(plan.MaxEntrySize.ValueString())
+		if err == nil {
+			if over := EntriesOver(archiver.Entries(), maxEntrySize); len(over) > 0 {
+				err = fmt.Errorf("%d entries are bigger than %s:\n%s", len(over),
+					FormatSize(maxEntrySize), DescribeLargestEntries(over))
+			}
+		}
+
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_entry_size"),
+				"entry size limit exceeded",
+				errors.Join(err, discardArchive(ctx, archiver)).Error())
+
+			return
+		}
+	}
+
+	err = archiver.Close(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError(
+			fmt.Sprintf("failed to close %s", plan.Name.ValueString()),
+			err.Error())
+
+		return
+	}
+
+	if !plan.MaxSize.IsNull() {
+		var size, maxSize int64
+
+		maxSize, err = ParseSize(plan.MaxSize.ValueString())
+		if err == nil {
+			size, err = Size(archName)
+		}
+
+		if err == nil && size > maxSize {
+			err = fmt.Errorf("%s is %s, more than %s, largest entries:\n%s", archName,
+				FormatSize(size), FormatSize(maxSize), DescribeLargestEntries(archiver.Entries()))
+		}
+
+		if err != nil {
+			if rmErr := os.Remove(archName); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+				err = errors.Join(err, rmErr)
+			}
+
+			resp.Diagnostics.AddAttributeError(
+				path.Root("max_size"),
+				"archive size limit exceeded",
+				err.Error())
+
+			return
+		}
+	}
+
+	plan.Base64 = types.StringNull()
+
+	if plan.IncludeBase64.ValueBool() {
+		// encoded before a split, which removes the archive.
+		plan.Base64, d = a.base64Value(plan.Base64MaxSize, func(limit int64) (string, error) {
+			return Base64(archName, limit)
+		})
+		resp.Diagnostics.Append(d...)
+
+		if d.HasError() {
+			if err := os.Remove(archName); err != nil && !errors.Is(err, os.ErrNotExist) {
+				resp.Diagnostics.AddError(fmt.Sprintf("can not delete %s", archName), err.Error())
+			}
+
+			return
+		}
+	}
+
+	var (
+		md5    string
+		sha256 string
+		size   int64
+	)
+
+	md5, sha256, err = Checksums(archName)
+	if err != nil {
+		resp.Diagnostics.AddWarning("computing md5 and sha2256",
+			fmt.Sprintf("could not compute md5 and sha256 outputs: %s", err))
+	}
+
+	plan.MD5 = types.StringValue(md5)
+	plan.SHA256 = types.StringValue(sha256)
+
+	size, err = Size(archName)
+	if err != nil {
+		resp.Diagnostics.AddWarning("compute file size",
+			fmt.Sprintf("can not compute file size for %s: %s",
+				archName, err))
+	}
+
+	plan.Size = types.Int64Value(size)
+	plan.AbsPath = types.StringValue(archName)
+
+	resp.Diagnostics.Append(a.setStats(ctx, &plan, archiver.Stats(), size)...)
+
+	if special := specialSkipped(archiver.Stats()); len(special) > 0 {
+		resp.Diagnostics.AddWarning("skipped special files",
+			fmt.Sprintf("%d devices, named pipes or sockets were not archived:\n  %s",
+				len(special), strings.Join(special, "\n  ")))
+	}
+	resp.Diagnostics.Append(a.setEntries(ctx, &plan, archiver.Entries())...)
+
+	plan.PlainMD5 = types.StringNull()
+	plan.PlainSHA256 = types.StringNull()
+
+	if pc, ok := archiver.(PlaintextChecksummer); ok {
+		if plainMD5, plainSHA256, encrypted := pc.PlaintextChecksums(); encrypted {
+			plan.PlainMD5 = types.StringValue(plainMD5)
+			plan.PlainSHA256 = types.StringValue(plainSHA256)
+		}
+	}
+
+	plan.Signature = types.StringNull()
+	plan.PublicKeyID = types.StringNull()
+	plan.SignaturePath = types.StringNull()
+
+	if plan.Signing != nil {
+		key, err := a.signingKey(plan.Signing)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("signing"),
+				"can not load signing key",
+				err.Error())
+
+			return
+		}
+
+		sig, sigPath, err := key.SignFile(archName, mode)
+		if err != nil {
+			resp.Diagnostics.AddError(
+				fmt.Sprintf("can not sign %s", archName),
+				err.Error())
+
+			return
+		}
+
+		plan.Signature = types.StringValue(string(sig))
+		plan.PublicKeyID = types.StringValue(key.KeyID())
+		plan.SignaturePath = types.StringValue(sigPath)
+	}
+
+	plan.Parts = types.ListNull(types.ObjectType{AttrTypes: splitPartAttrTypes})
+
+	// the checksum files list the archive, or its volumes once split.
+	checksummed := []Part{{Path: archName, Size: size, MD5: md5, SHA256: sha256}}
+
+	if !plan.SplitSize.IsNull() {
+		// checksums and signature describe the joined archive.
+		partSize, err := ParseSize(plan.SplitSize.ValueString())
+		if err == nil {
+			checksummed, err = SplitArchive(ctx, archName, partSize, mode)
+			if err == nil {
+				plan.Parts, d = partsValue(ctx, checksummed)
+				resp.Diagnostics.Append(d...)
+			}
+		}
+
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("split_size"),
+				fmt.Sprintf("can not split %s", archName),
+				err.Error())
+
+			return
+		}
+	}
+
+	plan.ChecksumFiles = types.ListNull(types.StringType)
+	plan.SumsManifest = types.StringNull()
+
+	if plan.ChecksumFile != nil {
+		// resolved once, later working directories may differ.
+		if !plan.ChecksumFile.Manifest.IsNull() {
+			manifest, err := filepath.Abs(plan.ChecksumFile.Manifest.ValueString())
+			if err != nil {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("checksum_file").AtName("manifest"),
+					"can not resolve manifest path",
+					err.Error())
+
+				return
+			}
+
+			plan.SumsManifest = types.StringValue(manifest)
+		}
+
+		paths, err := a.writeChecksumFiles(plan.ChecksumFile, plan.SumsManifest,
+			archName, checksummed, mode)
+		if err != nil {
+			resp.Diagnostics.AddError(
+				fmt.Sprintf("can not write checksum files for %s", archName),
+				err.Error())
+
+			return
+		}
+
+		plan.ChecksumFiles, d = types.ListValueFrom(ctx, types.StringType, paths)
+		resp.Diagnostics.Append(d...)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (a *archiveResource) Read(ctx context.Context,
+	req resource.ReadRequest, resp *resource.ReadResponse,
+) {
+	tflog.Debug(ctx, "refreshing state....")
+
+	var state Model
+
+	d := req.State.Get(ctx, &state)
+
+	resp.Diagnostics.Append(d...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	archName := state.AbsPath.ValueString()
+
+	if !state.Parts.IsNull() {
+		a.readParts(ctx, state, resp)
+
+		return
+	}
+
+	info, err := os.Stat(archName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			resp.State.RemoveResource(ctx)
+
+			state.MD5 = types.StringNull()
+			state.SHA256 = types.StringNull()
+			state.Size = types.Int64Null()
+
+			return
+		}
+
+		resp.Diagnostics.AddWarning(fmt.Sprintf("load %s info", archName),
+			fmt.Sprintf("load %s info: %s", archName, err))
+	}
+
+	state.Size = types.Int64Value(info.Size())
+
+	md5, sha256, err := Checksums(archName)
+	if err != nil {
+		resp.Diagnostics.AddWarning("computing md5 and sha2256",
+			fmt.Sprintf("could not refresh md5 and sha256 outputs: %s", err))
+	} else {
+		state.SHA256 = types.StringValue(sha256)
+		state.MD5 = types.StringValue(md5)
+	}
+
+	if state.Signing != nil && !state.SignaturePath.IsNull() {
+		key, err := a.signingKey(state.Signing)
+		if err != nil {
+			resp.Diagnostics.AddWarning("load signing key",
+				fmt.Sprintf("could not load signing key to verify %s: %s", archName, err))
+		} else if err := key.VerifyFile(archName, state.SignaturePath.ValueString()); err != nil {
+			// the archive or its signature were tampered with, recreate both.
+			resp.Diagnostics.AddWarning(fmt.Sprintf("verify %s signature", archName),
+				fmt.Sprintf("signature verification failed, the archive will be recreated: %s", err))
+
+			resp.State.RemoveResource(ctx)
+
+			return
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+// readParts checks the volumes of a split archive, a missing or modified
+// volume or a signature mismatch removes the resource so it is recreated.
+func (a *archiveResource) readParts(ctx context.Context, state Model,
+	resp *resource.ReadResponse,
+) {
+	parts, d := partsFromValue(ctx, state.Parts)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	for _, p := range parts {
+		md5, sha256, err := Checksums(p.Path)
+		if err != nil || md5 != p.MD5 || sha256 != p.SHA256 {
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				resp.Diagnostics.AddWarning(fmt.Sprintf("read %s", p.Path),
+					fmt.Sprintf("could not read volume, the archive will be recreated: %s", err))
+			}
+
+			resp.State.RemoveResource(ctx)
+
+			return
+		}
+	}
+
+	if state.Signing != nil && !state.SignaturePath.IsNull() {
+		key, err := a.signingKey(state.Signing)
+		if err != nil {
+			resp.Diagnostics.AddWarning("load signing key",
+				fmt.Sprintf("could not load signing key to verify %s: %s",
+					state.AbsPath.ValueString(), err))
+		} else {
+			sig, err := os.ReadFile(state.SignaturePath.ValueString())
+
+			var r io.ReadCloser
+			if err == nil {
+				r, err = OpenParts(parts)
+			}
+
+			if err == nil {
+				err = errors.Join(key.VerifyReader(r, sig), r.Close())
+			}
+
+			if err != nil {
+				resp.Diagnostics.AddWarning(fmt.Sprintf("verify %s signature", state.AbsPath.ValueString()),
+					fmt.Sprintf("signature verification failed, the archive will be recreated: %s", err))
+
+				resp.State.RemoveResource(ctx)
+
+				return
+			}
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (a *archiveResource) Update(ctx context.Context,
+	req resource.UpdateRequest, resp *resource.UpdateResponse,
+) {
+	tflog.Debug(ctx, "updating archive....")
+	var (
+		plan  Model
+		state Model
+		err   error
+	)
+
+	d := req.Plan.Get(ctx, &plan)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	d = req.State.Get(ctx, &state)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	updateTimeout, d := plan.Timeouts.Update(ctx, DefaultUpdateTimeout)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+
+	nameFromState := state.Name.ValueString()
+
+	if !plan.Name.IsNull() {
+		newName := plan.Name.ValueString()
+
+		if newName != nameFromState {
+			nameFromState, err = filepath.Abs(nameFromState)
+			if err != nil {
+				resp.Diagnostics.AddWarning("resolve old abs path",
+					fmt.Sprintf("could not resolve old abs path %s: %s", nameFromState, err))
+			}
+
+			newName, err = filepath.Abs(newName)
+			if err != nil {
+				resp.Diagnostics.AddWarning("resolve new abs path",
+					fmt.Sprintf("could not resolve new abs path %s: %s", newName, err))
+			}
+
+			if err == nil {
+				if state.Parts.IsNull() {
+					err = os.Rename(nameFromState, newName)
+					if err != nil {
+						resp.Diagnostics.AddWarning(fmt.Sprintf("rename archive file %s", nameFromState),
+							fmt.Sprintf("can not rename to %s: %s", newName, err))
+					}
+				} else {
+					state.Parts = a.moveParts(ctx, state, newName, resp)
+				}
+
+				plan.AbsPath = types.StringValue(newName)
+
+				if !state.SignaturePath.IsNull() {
+					oldSigPath := state.SignaturePath.ValueString()
+					newSigPath := newName + strings.TrimPrefix(oldSigPath, nameFromState)
+
+					err = os.Rename(oldSigPath, newSigPath)
+					if err != nil {
+						resp.Diagnostics.AddWarning(fmt.Sprintf("rename signature file %s", oldSigPath),
+							fmt.Sprintf("can not rename to %s: %s", newSigPath, err))
+					}
+
+					state.SignaturePath = types.StringValue(newSigPath)
+				}
+
+				if state.ChecksumFile != nil {
+					state.ChecksumFiles = a.moveChecksumFiles(ctx, state, nameFromState, newName, resp)
+				}
+			}
+		}
+	}
+
+	if !plan.OutMode.IsNull() {
+		newMode, err := strconv.ParseInt(plan.OutMode.ValueString(), 8, 32)
+		if err != nil {
+			resp.Diagnostics.AddWarning("change archive permission",
+				fmt.Sprintf("can not cahnge archive file perimssions: %s", err))
+		} else {
+			names := []string{nameFromState}
+
+			if !state.Parts.IsNull() {
+				parts, d := partsFromValue(ctx, state.Parts)
+				resp.Diagnostics.Append(d...)
+
+				names = names[:0]
+				for _, p := range parts {
+					names = append(names, p.Path)
+				}
+			}
+
+			for _, name := range names {
+				err = os.Chmod(name, os.FileMode(newMode))
+				if err != nil {
+					resp.Diagnostics.AddWarning(fmt.Sprintf("change %s mode", name),
+						fmt.Sprintf("could not change mode to %d: %s", newMode, err))
+				}
+			}
+
+			plan.OutMode = types.StringValue(fmt.Sprintf("%d", newMode))
+		}
+	}
+
+	plan.MD5 = state.MD5
+	plan.SHA256 = state.SHA256
+	plan.Size = state.Size
+	plan.Signature = state.Signature
+	plan.PublicKeyID = state.PublicKeyID
+	plan.SignaturePath = state.SignaturePath
+	plan.ChecksumFiles = state.ChecksumFiles
+	plan.SumsManifest = state.SumsManifest
+	plan.PlainMD5 = state.PlainMD5
+	plan.PlainSHA256 = state.PlainSHA256
+	plan.Parts = state.Parts
+	plan.EntryCount = state.EntryCount
+	plan.Uncompressed = state.Uncompressed
+	plan.Ratio = state.Ratio
+	plan.ExcludedCount = state.ExcludedCount
+	plan.Skipped = state.Skipped
+	plan.Entries = state.Entries
+	plan.Base64 = state.Base64
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (a *archiveResource) Delete(ctx context.Context,
+	req resource.DeleteRequest, resp *resource.DeleteResponse,
+) {
+	var (
+		archive string
+		err     error
+	)
+
+	d := req.State.GetAttribute(ctx, path.Root("abs_path"), &archive)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var partsList types.List
+
+	d = req.State.GetAttribute(ctx, path.Root("parts"), &partsList)
+	resp.Diagnostics.Append(d...)
+
+	if partsList.IsNull() {
+		err = os.Remove(archive)
+	} else {
+		var parts []Part
+
+		parts, d = partsFromValue(ctx, partsList)
+		resp.Diagnostics.Append(d...)
+
+		err = RemoveParts(parts)
+	}
+
+	if err != nil {
+		resp.Diagnostics.AddError(
+			"can not delete archive",
+			fmt.Sprintf("can not delete %s: %s",
+				archive, err))
+	}
+
+	var (
+		checksumFile *ChecksumFile
+		manifest     types.String
+	)
+
+	d = req.State.GetAttribute(ctx, path.Root("checksum_file"), &checksumFile)
+	resp.Diagnostics.Append(d...)
+
+	d = req.State.GetAttribute(ctx, path.Root("checksum_manifest_path"), &manifest)
+	resp.Diagnostics.Append(d...)
+
+	if checksumFile != nil {
+		if err := a.removeChecksumFiles(checksumFile, manifest, archive); err != nil {
+			resp.Diagnostics.AddError(
+				"can not delete checksum files",
+				fmt.Sprintf("can not delete checksum files of %s: %s",
+					archive, err))
+		}
+	}
+
+	var sigPath types.String
+
+	d = req.State.GetAttribute(ctx, path.Root("signature_path"), &sigPath)
+	resp.Diagnostics.Append(d...)
+
+	if resp.Diagnostics.HasError() || sigPath.IsNull() {
+		return
+	}
+
+	err = os.Remove(sigPath.ValueString())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		resp.Diagnostics.AddError(
+			"can not delete signature",
+			fmt.Sprintf("can not delete %s: %s",
+				sigPath.ValueString(), err))
+	}
+}
+
+func (a *archiveResource) cleanPath(path string) (string, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	relPath := filepath.Clean(path)
+
+	for strings.HasPrefix(relPath, "../") {
+		relPath = strings.TrimPrefix(relPath, "../")
+	}
+
+	return absPath, relPath, nil
+}
+
+// signingKey loads the private key configured in the signing block.
+func (a *archiveResource) signingKey(signing *Signing) (*SigningKey, error) {
+	format := SignatureFormatEd25519
+	if !signing.Format.IsNull() {
+		format = signing.Format.ValueString()
+	}
+
+	b := []byte(signing.PrivateKey.ValueString())
+
+	if !signing.PrivateKeyFile.IsNull() {
+		var err error
+
+		b, err = os.ReadFile(signing.PrivateKeyFile.ValueString())
+		if err != nil {
+			return nil, fmt.Errorf("error signingKey: read %s: %w",
+				signing.PrivateKeyFile.ValueString(), err)
+		}
+	}
+
+	return ParseSigningKey(format, b)
+}
+
+// writeChecksumFiles writes the checksum files of archName configured in checksumFile,
+// listing files, and returns their paths, the shared manifest included.
+func (a *archiveResource) writeChecksumFiles(checksumFile *ChecksumFile, manifest types.String,
+	archName string, files []Part, mode os.FileMode,
+) ([]string, error) {
+	paths := make([]string, 0, 3)
+
+	sums := []struct {
+		enabled types.Bool
+		algo    string
+	}{
+		{enabled: checksumFile.SHA256, algo: ChecksumSHA256},
+		{enabled: checksumFile.MD5, algo: ChecksumMD5},
+	}
+
+	for _, s := range sums {
+		if !s.enabled.ValueBool() {
+			continue
+		}
+
+		name, err := WriteChecksumFile(archName, s.algo, files, mode)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, name)
+	}
+
+	if !manifest.IsNull() {
+		if err := AddToChecksumManifest(manifest.ValueString(), archName, files, mode); err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, manifest.ValueString())
+	}
+
+	return paths, nil
+}
+
+// removeChecksumFiles removes the checksum files of archName
+// and its lines from the shared manifest.
+func (a *archiveResource) removeChecksumFiles(checksumFile *ChecksumFile, manifest types.String,
+	archName string,
+) error {
+	var errs []error
+
+	for _, s := range []struct {
+		enabled types.Bool
+		algo    string
+	}{
+		{enabled: checksumFile.SHA256, algo: ChecksumSHA256},
+		{enabled: checksumFile.MD5, algo: ChecksumMD5},
+	} {
+		if !s.enabled.ValueBool() {
+			continue
+		}
+
+		err := os.Remove(ChecksumFilePath(archName, s.algo))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	if !manifest.IsNull() {
+		errs = append(errs, RemoveFromChecksumManifest(manifest.ValueString(), archName))
+	}
+
+	return errors.Join(errs...)
+}
+
+// moveChecksumFiles rewrites the checksum files of a renamed archive
+// and returns their new paths.
+func (a *archiveResource) moveChecksumFiles(ctx context.Context, state Model,
+	oldName, newName string, resp *resource.UpdateResponse,
+) types.List {
+	if err := a.removeChecksumFiles(state.ChecksumFile, state.SumsManifest, oldName); err != nil {
+		resp.Diagnostics.AddWarning(fmt.Sprintf("remove checksum files of %s", oldName),
+			err.Error())
+	}
+
+	mode := DefaultArchiveMode
+
+	if info, err := os.Stat(newName); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	files := []Part{{
+		Path:   newName,
+		Size:   state.Size.ValueInt64(),
+		MD5:    state.MD5.ValueString(),
+		SHA256: state.SHA256.ValueString(),
+	}}
+
+	if !state.Parts.IsNull() {
+		var d diag.Diagnostics
 
-	var state Model
+		// moved by moveParts already.
+		files, d = partsFromValue(ctx, state.Parts)
+		resp.Diagnostics.Append(d...)
+	}
 
-	d := req.State.Get(ctx, &state)
+	paths, err := a.writeChecksumFiles(state.ChecksumFile, state.SumsManifest, newName, files, mode)
+	if err != nil {
+		resp.Diagnostics.AddWarning(fmt.Sprintf("write checksum files of %s", newName),
+			err.Error())
+	}
 
+	list, d := types.ListValueFrom(ctx, types.StringType, paths)
 	resp.Diagnostics.Append(d...)
-	if resp.Diagnostics.HasError() {
-		return
-	}
 
-	archName := state.AbsPath.ValueString()
+	return list
+}
 
-	info, err := os.Stat(archName)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			resp.State.RemoveResource(ctx)
+// moveParts renames the volumes of a split archive to match newName
+// and returns their new paths.
+func (a *archiveResource) moveParts(ctx context.Context, state Model,
+	newName string, resp *resource.UpdateResponse,
+) types.List {
+	parts, d := partsFromValue(ctx, state.Parts)
+	resp.Diagnostics.Append(d...)
 
-			state.MD5 = types.StringNull()
-			state.SHA256 = types.StringNull()
-			state.Size = types.Int64Null()
+	for i := range parts {
+		newPath := PartPath(newName, i+1)
 
-			return
+		if err := os.Rename(parts[i].Path, newPath); err != nil {
+			resp.Diagnostics.AddWarning(fmt.Sprintf("rename volume %s", parts[i].Path),
+				fmt.Sprintf("can not rename to %s: %s", newPath, err))
+
+			continue
 		}
 
-		resp.Diagnostics.AddWarning(fmt.Sprintf("load %s info", archName),
-			fmt.Sprintf("load %s info: %s", archName, err))
+		parts[i].Path = newPath
 	}
 
-	state.Size = types.Int64Value(info.Size())
+	list, d := partsValue(ctx, parts)
+	resp.Diagnostics.Append(d...)
 
-	md5, sha256, err := Checksums(archName)
-	if err != nil {
-		resp.Diagnostics.AddWarning("computing md5 and sha2256",
-			fmt.Sprintf("could not refresh md5 and sha256 outputs: %s", err))
-	} else {
-		state.SHA256 = types.StringValue(sha256)
-		state.MD5 = types.StringValue(md5)
+	return list
+}
+
+func partsValue(ctx context.Context, parts []Part) (types.List, diag.Diagnostics) {
+	values := make([]SplitPart, 0, len(parts))
+
+	for _, p := range parts {
+		values = append(values, SplitPart{
+			Path:   types.StringValue(p.Path),
+			Size:   types.Int64Value(p.Size),
+			MD5:    types.StringValue(p.MD5),
+			SHA256: types.StringValue(p.SHA256),
+		})
 	}
 
-	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+	return types.ListValueFrom(ctx, types.ObjectType{AttrTypes: splitPartAttrTypes}, values)
 }
 
-func (a *archiveResource) Update(ctx context.Context,
-	req resource.UpdateRequest, resp *resource.UpdateResponse,
-) {
-	tflog.Debug(ctx, "updating archive....")
-	var (
-		plan  Model
-		state Model
-		err   error
-	)
+func partsFromValue(ctx context.Context, list types.List) ([]Part, diag.Diagnostics) {
+	values := make([]SplitPart, 0, len(list.Elements()))
 
-	d := req.Plan.Get(ctx, &plan)
-	resp.Diagnostics.Append(d...)
+	d := list.ElementsAs(ctx, &values, false)
 
-	if resp.Diagnostics.HasError() {
-		return
+	parts := make([]Part, 0, len(values))
+
+	for _, v := range values {
+		parts = append(parts, Part{
+			Path:   v.Path.ValueString(),
+			Size:   v.Size.ValueInt64(),
+			MD5:    v.MD5.ValueString(),
+			SHA256: v.SHA256.ValueString(),
+		})
 	}
 
-	d = req.State.Get(ctx, &state)
-	resp.Diagnostics.Append(d...)
+	return parts, d
+}
 
-	if resp.Diagnostics.HasError() {
-		return
+// base64Value returns the archive base64 encoded by encode,
+// which fails with ErrTooBig when it is bigger than base64MaxSize.
+func (a *archiveResource) base64Value(base64MaxSize types.String,
+	encode func(limit int64) (string, error),
+) (types.String, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	maxSize := DefaultBase64MaxSize
+	if !base64MaxSize.IsNull() {
+		maxSize = base64MaxSize.ValueString()
 	}
 
-	nameFromState := state.Name.ValueString()
+	limit, err := ParseSize(maxSize)
+	if err != nil {
+		diags.AddAttributeError(
+			path.Root("base64_max_size"),
+			"invalid size",
+			err.Error())
 
-	if !plan.Name.IsNull() {
-		newName := plan.Name.ValueString()
+		return types.StringNull(), diags
+	}
 
-		if newName != nameFromState {
-			nameFromState, err = filepath.Abs(nameFromState)
-			if err != nil {
-				resp.Diagnostics.AddWarning("resolve old abs path",
-					fmt.Sprintf("could not resolve old abs path %s: %s", nameFromState, err))
-			}
+	encoded, err := encode(limit)
 
-			newName, err = filepath.Abs(newName)
-			if err != nil {
-				resp.Diagnostics.AddWarning("resolve new abs path",
-					fmt.Sprintf("could not resolve new abs path %s: %s", newName, err))
-			}
+	switch {
+	case errors.Is(err, ErrTooBig):
+		diags.AddAttributeError(
+			path.Root("base64_max_size"),
+			"archive too big for output_base64",
+			err.Error())
+	case err != nil:
+		diags.AddError("can not encode output_base64", err.Error())
+	default:
+		return types.StringValue(encoded), diags
+	}
 
-			if err == nil {
-				err = os.Rename(nameFromState, newName)
-				if err != nil {
-					resp.Diagnostics.AddWarning(fmt.Sprintf("rename archive file %s", nameFromState),
-						fmt.Sprintf("can not rename to %s: %s", newName, err))
-				}
+	return types.StringNull(), diags
+}
 
-				plan.AbsPath = types.StringValue(newName)
-			}
-		}
+// setStats sets the entry_count, uncompressed_size, compression_ratio,
+// excluded_count and skipped attributes of an archive of size bytes.
+func (a *archiveResource) setStats(ctx context.Context, plan *Model,
+	stats Stats, size int64,
+) diag.Diagnostics {
+	plan.EntryCount = types.Int64Value(int64(stats.EntryCount))
+	plan.Uncompressed = types.Int64Value(stats.UncompressedSize)
+	plan.ExcludedCount = types.Int64Value(int64(stats.ExcludedCount))
+	plan.Ratio = types.Float64Null()
+
+	if size > 0 {
+		plan.Ratio = types.Float64Value(float64(stats.UncompressedSize) / float64(size))
 	}
 
-	if !plan.OutMode.IsNull() {
-		newMode, err := strconv.ParseInt(plan.OutMode.ValueString(), 8, 32)
-		if err != nil {
-			resp.Diagnostics.AddWarning("change archive permission",
-				fmt.Sprintf("can not cahnge archive file perimssions: %s", err))
-		} else {
-			err = os.Chmod(nameFromState, os.FileMode(newMode))
-			if err != nil {
-				resp.Diagnostics.AddWarning(fmt.Sprintf("change %s mode", nameFromState),
-					fmt.Sprintf("could not change mode to %d: %s", newMode, err))
-			}
+	skipped := make([]SkippedPath, 0, len(stats.Skipped))
 
-			plan.OutMode = types.StringValue(fmt.Sprintf("%d", newMode))
-		}
+	for _, s := range stats.Skipped {
+		skipped = append(skipped, SkippedPath{
+			Path:   types.StringValue(s.Path),
+			Reason: types.StringValue(s.Reason),
+		})
 	}
 
-	plan.MD5 = state.MD5
-	plan.SHA256 = state.SHA256
-	plan.Size = state.Size
+	var d diag.Diagnostics
 
-	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
-}
+	plan.Skipped, d = types.ListValueFrom(ctx, types.ObjectType{AttrTypes: skippedPathAttrTypes}, skipped)
 
-func (a *archiveResource) Delete(ctx context.Context,
-	req resource.DeleteRequest, resp *resource.DeleteResponse,
-) {
-	var (
-		archive string
-		err     error
-	)
+	return d
+}
 
-	d := req.State.GetAttribute(ctx, path.Root("abs_path"), &archive)
-	resp.Diagnostics.Append(d...)
+// specialSkipped returns the skipped devices, named pipes and sockets.
+func specialSkipped(stats Stats) []string {
+	special := make([]string, 0)
 
-	if resp.Diagnostics.HasError() {
-		return
+	for _, s := range stats.Skipped {
+		if s.Special {
+			special = append(special, s.Path)
+		}
 	}
 
-	err = os.Remove(archive)
-	if err != nil {
-		resp.Diagnostics.AddError(
-			"can not delete archive",
-			fmt.Sprintf("can not delete %s: %s",
-				archive, err))
-	}
+	return special
 }
 
-func (a *archiveResource) cleanPath(path string) (string, string, error) {
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return "", "", err
-	}
+// setEntries sets the entries attribute from the entries written to the archive.
+func (a *archiveResource) setEntries(ctx context.Context, plan *Model, entries []Entry) diag.Diagnostics {
+	var d diag.Diagnostics
 
-	relPath := filepath.Clean(path)
+	plan.Entries, d = entriesValue(ctx, entries)
 
-	for strings.HasPrefix(relPath, "../") {
-		relPath = strings.TrimPrefix(relPath, "../")
+	return d
+}
+
+func entriesValue(ctx context.Context, entries []Entry) (types.List, diag.Diagnostics) {
+	values := make([]ArchivedEntry, 0, len(entries))
+
+	for _, e := range entries {
+		values = append(values, ArchivedEntry{
+			Path:   types.StringValue(e.Path),
+			Size:   types.Int64Value(e.Size),
+			Mode:   types.StringValue(fmt.Sprintf("%04o", e.Mode)),
+			SHA256: types.StringValue(e.SHA256),
+		})
 	}
 
-	return absPath, relPath, nil
+	return types.ListValueFrom(ctx, types.ObjectType{AttrTypes: archivedEntryAttrTypes}, values)
 }
 
 func Checksums(name string) (string, string, error) {
@@ -488,10 +2562,16 @@ func Checksums(name string) (string, string, error) {
 	return md5, sha256, nil
 }
 
+// appendFiles adds files to the archive, failing entries are logged and skipped
+// only a cancelled or timed out ctx stops the loop and is returned.
 func (a *archiveResource) appendFiles(ctx context.Context,
 	archiver Archiver, files ...File,
-) {
+) error {
+	defer setEntryOwner(archiver, EntryOwner{})
+
 	for _, f := range files {
+		setEntryOwner(archiver, f.EntryOwner)
+
 		orgPath := f.Path.ValueString()
 
 		absPath, relPath, err := a.cleanPath(orgPath)
@@ -504,7 +2584,11 @@ func (a *archiveResource) appendFiles(ctx context.Context,
 			continue
 		}
 
-		if err := archiver.ArchiveFile(absPath, relPath); err != nil {
+		if err := archiver.ArchiveFile(ctx, absPath, relPath); err != nil {
+			if isContextError(err) {
+				return err
+			}
+
 			tflog.Error(ctx, "can not add file to archive",
 				map[string]interface{}{
 					"path": orgPath,
@@ -512,12 +2596,20 @@ func (a *archiveResource) appendFiles(ctx context.Context,
 				})
 		}
 	}
+
+	return nil
 }
 
+// appendDirs adds dirs to the archive, failing entries are logged and skipped
+// only a cancelled or timed out ctx stops the loop and is returned.
 func (a *archiveResource) appendDirs(ctx context.Context,
 	archiver Archiver, dirs ...Dir,
-) {
+) error {
+	defer setEntryOwner(archiver, EntryOwner{})
+
 	for _, d := range dirs {
+		setEntryOwner(archiver, d.EntryOwner)
+
 		orgPath := d.Path.ValueString()
 
 		absPath, relPath, err := a.cleanPath(orgPath)
@@ -530,7 +2622,11 @@ func (a *archiveResource) appendDirs(ctx context.Context,
 			continue
 		}
 
-		if err := archiver.ArchiveDir(absPath, relPath); err != nil {
+		if err := archiver.ArchiveDir(ctx, absPath, relPath); err != nil {
+			if isContextError(err) {
+				return err
+			}
+
 			tflog.Error(ctx, "can not add dir to archive",
 				map[string]interface{}{
 					"path": orgPath,
@@ -538,33 +2634,286 @@ func (a *archiveResource) appendDirs(ctx context.Context,
 				})
 		}
 	}
+
+	return nil
+}
+
+// discardArchive closes archiver with a cancelled context
+// so the partially written archive is removed instead of committed.
+func discardArchive(ctx context.Context, archiver Archiver) error {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := archiver.Close(ctx); err != nil && !isContextError(err) {
+		return err
+	}
+
+	return nil
+}
+
+// contentBytes returns the text of c or its decoded base64 bytes.
+func contentBytes(c Content) ([]byte, error) {
+	if !c.Text.IsNull() {
+		return []byte(c.Text.ValueString()), nil
+	}
+
+	encoded := c.Base64
+	if encoded.IsNull() {
+		encoded = c.Src
+	}
+
+	b, err := base64.StdEncoding.DecodeString(encoded.ValueString())
+	if err != nil {
+		return nil, fmt.Errorf("error contentBytes: decode %s: %w",
+			c.FilePath.ValueString(), err)
+	}
+
+	return b, nil
 }
 
+// appendContents adds contents to the archive, undecodable contents and
+// a cancelled or timed out ctx stop the loop and are returned
+// other failing entries are logged and skipped.
 func (a *archiveResource) appendContents(ctx context.Context,
 	archiver Archiver, contents ...Content,
-) {
+) error {
+	defer setEntryOwner(archiver, EntryOwner{})
+
 	for _, c := range contents {
-		b, err := base64.StdEncoding.DecodeString(c.Src.ValueString())
+		b, err := contentBytes(c)
 		if err != nil {
-			tflog.Error(ctx, "can not decode content",
+			return err
+		}
+
+		relPath := entryPath(c.FilePath.ValueString())
+
+		setEntryOwner(archiver, c.EntryOwner)
+
+		if err := archiver.ArchiveContent(ctx, b, relPath, DefaultContentMode); err != nil {
+			if isContextError(err) {
+				return err
+			}
+
+			tflog.Error(ctx, "can not add content to archive",
 				map[string]interface{}{
-					"dst": c.FilePath.ValueString(),
-					"err": err,
+					"path": relPath,
+					"err":  err,
 				})
 		}
+	}
+
+	return nil
+}
+
+// appendTemplates renders templates and adds them to the archive, templates
+// failing to render and a cancelled or timed out ctx stop the loop and are
+// returned, other failing entries are logged and skipped.
+func (a *archiveResource) appendTemplates(ctx context.Context,
+	archiver Archiver, templates ...Template,
+) error {
+	for _, t := range templates {
+		vars := make(map[string]string, len(t.Vars.Elements()))
+
+		if d := t.Vars.ElementsAs(ctx, &vars, false); d.HasError() {
+			return fmt.Errorf("error appendTemplates: read vars of %s", t.Source.ValueString())
+		}
 
-		relPath := filepath.Clean(c.FilePath.ValueString())
+		b, err := RenderTemplate(t.Source.ValueString(), vars)
+		if err != nil {
+			return err
+		}
 
-		for strings.HasPrefix(relPath, "../") {
-			relPath = strings.TrimPrefix(relPath, "../")
+		mode, err := entryMode(t.Mode)
+		if err != nil {
+			return fmt.Errorf("error appendTemplates: %w", err)
 		}
 
-		if err := archiver.ArchiveContent(b, relPath); err != nil {
-			tflog.Error(ctx, "can not add content to archive",
+		relPath := entryPath(t.FilePath.ValueString())
+
+		if err := archiver.ArchiveContent(ctx, b, relPath, mode); err != nil {
+			if isContextError(err) {
+				return err
+			}
+
+			tflog.Error(ctx, "can not add template to archive",
 				map[string]interface{}{
 					"path": relPath,
 					"err":  err,
 				})
 		}
 	}
+
+	return nil
+}
+
+// appendSourceArchives copies the selected entries of sources to the archive
+// a source failing to be read stops the loop and is returned.
+func (a *archiveResource) appendSourceArchives(ctx context.Context,
+	archiver Archiver, sources ...SourceArchive,
+) error {
+	for _, s := range sources {
+		filter := &SourceFilter{
+			Include: make([]string, 0, len(s.Include.Elements())),
+			Exclude: make([]string, 0, len(s.Exclude.Elements())),
+		}
+
+		if !s.Prefix.IsNull() {
+			filter.Prefix = entryPath(s.Prefix.ValueString())
+		}
+
+		if d := s.Include.ElementsAs(ctx, &filter.Include, false); d.HasError() {
+			return fmt.Errorf("error appendSourceArchives: read include of %s", s.Path.ValueString())
+		}
+
+		if d := s.Exclude.ElementsAs(ctx, &filter.Exclude, false); d.HasError() {
+			return fmt.Errorf("error appendSourceArchives: read exclude of %s", s.Path.ValueString())
+		}
+
+		src, err := filepath.Abs(s.Path.ValueString())
+		if err != nil {
+			return fmt.Errorf("error appendSourceArchives: resolve %s: %w", s.Path.ValueString(), err)
+		}
+
+		if err := archiver.MergeArchive(ctx, src, filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendNested builds every nested archive in a temporary directory
+// and adds it to the archive, a nested archive failing to be built
+// stops the loop and is returned.
+func (a *archiveResource) appendNested(ctx context.Context,
+	archiver Archiver, opts []Options, nested ...Nested,
+) error {
+	for _, n := range nested {
+		if err := a.appendNestedArchive(ctx, archiver, opts, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *archiveResource) appendNestedArchive(ctx context.Context,
+	archiver Archiver, opts []Options, n Nested,
+) error {
+	inner := GetArchiver(n.Type.ValueString())
+	if inner == nil {
+		return fmt.Errorf("error appendNestedArchive: unsupported archive type %s",
+			n.Type.ValueString())
+	}
+
+	var (
+		files    = make([]File, 0, len(n.FileBlocks.Elements()))
+		dirs     = make([]Dir, 0, len(n.DirBlocks.Elements()))
+		contents = make([]Content, 0, len(n.ContentBlocks.Elements()))
+	)
+
+	d := n.FileBlocks.ElementsAs(ctx, &files, false)
+	d.Append(n.DirBlocks.ElementsAs(ctx, &dirs, false)...)
+	d.Append(n.ContentBlocks.ElementsAs(ctx, &contents, false)...)
+
+	if d.HasError() {
+		return fmt.Errorf("error appendNestedArchive: read blocks of %s", n.FilePath.ValueString())
+	}
+
+	tmpDir, err := os.MkdirTemp("", "archiver-nested-")
+	if err != nil {
+		return fmt.Errorf("error appendNestedArchive: create temporary directory: %w", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	relPath := entryPath(n.FilePath.ValueString())
+	name := filepath.Join(tmpDir, filepath.Base(relPath))
+
+	if err := inner.Open(ctx, name, opts...); err != nil {
+		return err
+	}
+
+	err = a.appendFiles(ctx, inner, files...)
+
+	if err == nil {
+		err = a.appendDirs(ctx, inner, dirs...)
+	}
+
+	if err == nil {
+		err = a.appendContents(ctx, inner, contents...)
+	}
+
+	if err != nil {
+		return errors.Join(err, discardArchive(ctx, inner))
+	}
+
+	if err := inner.Close(ctx); err != nil {
+		return err
+	}
+
+	return archiver.ArchiveFile(ctx, name, relPath)
+}
+
+// ownerSettings returns the owner set in o, nil if none is set.
+func ownerSettings(o EntryOwner, numericOwner bool) *OwnerSettings {
+	if o.Owner.IsNull() && o.Group.IsNull() && o.UID.IsNull() && o.GID.IsNull() && !numericOwner {
+		return nil
+	}
+
+	settings := &OwnerSettings{
+		Owner:        o.Owner.ValueString(),
+		Group:        o.Group.ValueString(),
+		UID:          KeepID,
+		GID:          KeepID,
+		NumericOwner: numericOwner,
+	}
+
+	if !o.UID.IsNull() {
+		settings.UID = int(o.UID.ValueInt64())
+	}
+
+	if !o.GID.IsNull() {
+		settings.GID = int(o.GID.ValueInt64())
+	}
+
+	return settings
+}
+
+// setEntryOwner overrides the owner of the next entries with the one of a block
+// for archivers writing owners, an empty owner restores the one of the archive.
+func setEntryOwner(archiver Archiver, owner EntryOwner) {
+	if s, ok := archiver.(EntryOwnerSetter); ok {
+		s.SetEntryOwner(ownerSettings(owner, false))
+	}
+}
+
+// entryPath cleans the path of an entry and strips its leading ../
+// so it can not point outside of the archive.
+func entryPath(name string) string {
+	relPath := filepath.Clean(name)
+
+	for strings.HasPrefix(relPath, "../") {
+		relPath = strings.TrimPrefix(relPath, "../")
+	}
+
+	return relPath
+}
+
+// entryMode parses the octal mode of an entry, DefaultContentMode if null.
+func entryMode(mode types.String) (os.FileMode, error) {
+	if mode.IsNull() {
+		return DefaultContentMode, nil
+	}
+
+	m, err := strconv.ParseUint(mode.ValueString(), 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("parse mode %s: %w", mode.ValueString(), err)
+	}
+
+	if m > uint64(os.ModePerm) {
+		return 0, fmt.Errorf("mode %s is not a permission mode", mode.ValueString())
+	}
+
+	return os.FileMode(m), nil
 }
@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nestedBlockSet(t *testing.T, block string, values any) types.Set {
+	t.Helper()
+
+	var resp resource.SchemaResponse
+
+	NewArchiveResource().Schema(context.Background(), resource.SchemaRequest{}, &resp)
+
+	nested, ok := resp.Schema.Blocks["nested"].(schema.SetNestedBlock)
+
+	require.True(t, ok)
+
+	setType, ok := nested.NestedObject.Blocks[block].Type().(types.SetType)
+
+	require.True(t, ok)
+
+	set, d := types.SetValueFrom(context.Background(), setType.ElemType, values)
+
+	require.False(t, d.HasError())
+
+	return set
+}
+
+func TestArchiveResource_AppendNestedArchive(t *testing.T) {
+	contents := []Content{
+		{
+			Text:     types.StringValue("exports.handler = () => {}"),
+			FilePath: types.StringValue("index.js"),
+		},
+		{
+			Base64:   types.StringValue("Y29uZmln"),
+			FilePath: types.StringValue("etc/config"),
+		},
+	}
+
+	tests := []struct {
+		name      string
+		outerType string
+		innerType string
+		ctx       func() context.Context
+		success   bool
+	}{
+		{
+			name:      "zip in zip",
+			outerType: "zip",
+			innerType: "zip",
+			ctx:       context.Background,
+			success:   true,
+		},
+		{
+			name:      "tar.gz in zip",
+			outerType: "zip",
+			innerType: "tar.gz",
+			ctx:       context.Background,
+			success:   true,
+		},
+		{
+			name:      "zip in tar.gz",
+			outerType: "tar.gz",
+			innerType: "zip",
+			ctx:       context.Background,
+			success:   true,
+		},
+		{
+			name:      "unsupported type",
+			outerType: "zip",
+			innerType: "rar",
+			ctx:       context.Background,
+		},
+		{
+			name:      "cancelled context",
+			outerType: "zip",
+			innerType: "tar.gz",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				return ctx
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "outer."+test.outerType)
+			entry := "layers/inner." + test.innerType
+
+			outer := GetArchiver(test.outerType)
+
+			require.Nil(t, outer.Open(context.Background(), name))
+
+			err := (&archiveResource{}).appendNestedArchive(test.ctx(), outer, nil, Nested{
+				FilePath:      types.StringValue("../" + entry),
+				Type:          types.StringValue(test.innerType),
+				FileBlocks:    nestedBlockSet(t, "file", []File{}),
+				DirBlocks:     nestedBlockSet(t, "dir", []Dir{}),
+				ContentBlocks: nestedBlockSet(t, "content", contents),
+			})
+
+			require.Nil(t, outer.Close(context.Background()))
+
+			if !test.success {
+				assert.NotNil(t, err)
+
+				entries, err := ListEntries(context.Background(), name)
+
+				require.Nil(t, err)
+
+				assert.Empty(t, entries)
+
+				return
+			}
+
+			require.Nil(t, err)
+
+			b, err := ReadEntry(context.Background(), name, entry)
+
+			require.Nil(t, err)
+
+			inner := filepath.Join(dir, filepath.Base(entry))
+
+			require.Nil(t, os.WriteFile(inner, b, 0o644))
+
+			for _, c := range []struct {
+				name    string
+				content string
+			}{
+				{name: "index.js", content: "exports.handler = () => {}"},
+				{name: "etc/config", content: "config"},
+			} {
+				b, err := ReadEntry(context.Background(), inner, c.name)
+
+				require.Nil(t, err)
+
+				assert.Equal(t, c.content, string(b))
+			}
+		})
+	}
+}
+
+func TestArchiveResource_ValidateContents(t *testing.T) {
+	var resp resource.SchemaResponse
+
+	NewArchiveResource().Schema(context.Background(), resource.SchemaRequest{}, &resp)
+
+	setType, ok := resp.Schema.Blocks["content"].Type().(types.SetType)
+
+	require.True(t, ok)
+
+	tests := []struct {
+		name    string
+		content Content
+		detail  string
+	}{
+		{
+			name:    "text",
+			content: Content{Text: types.StringValue("text"), FilePath: types.StringValue("a.txt")},
+		},
+		{
+			name:    "deprecated src",
+			content: Content{Src: types.StringValue("dGV4dA=="), FilePath: types.StringValue("a.txt")},
+		},
+		{
+			name:    "none",
+			content: Content{FilePath: types.StringValue("a.txt")},
+			detail:  "exactly one of text and base64, or the deprecated src, must be set for a.txt",
+		},
+		{
+			name: "src and base64",
+			content: Content{
+				Src:      types.StringValue("dGV4dA=="),
+				Base64:   types.StringValue("dGV4dA=="),
+				FilePath: types.StringValue("a.txt"),
+			},
+			detail: "exactly one of text and base64, or the deprecated src, must be set for a.txt",
+		},
+		{
+			name:    "invalid base64",
+			content: Content{Base64: types.StringValue("!"), FilePath: types.StringValue("a.txt")},
+			detail:  "error contentBytes: decode a.txt: illegal base64 data at input byte 0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, d := types.SetValueFrom(context.Background(), setType.ElemType, []Content{test.content})
+
+			require.False(t, d.HasError())
+
+			(&archiveResource{}).validateContents(context.Background(), set, path.Root("content"), &d)
+
+			if test.detail == "" {
+				assert.False(t, d.HasError())
+
+				return
+			}
+
+			require.Len(t, d, 1)
+
+			assert.Equal(t, test.detail, d[0].Detail())
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	SignatureFormatEd25519  = "ed25519"
+	SignatureFormatMinisign = "minisign"
+)
+
+var (
+	minisignAlgEd      = []byte("Ed")
+	minisignAlgHashed  = []byte("ED")
+	minisignChkBlake2b = []byte("B2")
+)
+
+const (
+	minisignKeyIDSize = 8
+	// sig_alg, kdf_alg, chk_alg, kdf_salt, kdf_opslimit, kdf_memlimit,
+	// key id, secret key and checksum.
+	minisignSecretKeySize = 2 + 2 + 2 + 32 + 8 + 8 + minisignKeyIDSize + ed25519.PrivateKeySize + 32
+	// sig_alg, key id and signature.
+	minisignSignatureSize = 2 + minisignKeyIDSize + ed25519.SignatureSize
+)
+
+// SigningKey is an ed25519 key producing detached signatures
+// either as a base64 encoded raw signature or in the minisign format.
+type SigningKey struct {
+	format  string
+	private ed25519.PrivateKey
+	keyID   []byte
+}
+
+// ParseSigningKey parses a PEM encoded PKCS #8 ed25519 private key
+// for the ed25519 format, or an unencrypted minisign secret key
+// (minisign -G -W) for the minisign format.
+func ParseSigningKey(format string, b []byte) (*SigningKey, error) {
+	switch format {
+	case SignatureFormatEd25519:
+		return parseEd25519Key(b)
+	case SignatureFormatMinisign:
+		return parseMinisignKey(b)
+	default:
+		return nil, fmt.Errorf("error ParseSigningKey: unsupported format %s", format)
+	}
+}
+
+func parseEd25519Key(b []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("error parseEd25519Key: no PEM block found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parseEd25519Key: parse private key: %w", err)
+	}
+
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("error parseEd25519Key: expected an ed25519 key, got %T", key)
+	}
+
+	// the last 32 bytes of an ed25519 private key are its public key.
+	pubHash := sha256.Sum256(private[ed25519.SeedSize:])
+
+	return &SigningKey{
+		format:  SignatureFormatEd25519,
+		private: private,
+		keyID:   pubHash[:minisignKeyIDSize],
+	}, nil
+}
+
+func parseMinisignKey(b []byte) (*SigningKey, error) {
+	encoded := lastLine(b)
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error parseMinisignKey: decode secret key: %w", err)
+	}
+
+	if len(raw) != minisignSecretKeySize {
+		return nil, fmt.Errorf("error parseMinisignKey: invalid secret key size %d", len(raw))
+	}
+
+	if !bytes.Equal(raw[:2], minisignAlgEd) {
+		return nil, errors.New("error parseMinisignKey: unsupported signature algorithm")
+	}
+
+	if !bytes.Equal(raw[2:4], []byte{0, 0}) {
+		return nil, errors.New("error parseMinisignKey: encrypted secret keys are not supported, " +
+			"generate the key with minisign -G -W")
+	}
+
+	if !bytes.Equal(raw[4:6], minisignChkBlake2b) {
+		return nil, errors.New("error parseMinisignKey: unsupported checksum algorithm")
+	}
+
+	keyNum := raw[54:]
+	keyID := keyNum[:minisignKeyIDSize]
+	private := ed25519.PrivateKey(keyNum[minisignKeyIDSize : minisignKeyIDSize+ed25519.PrivateKeySize])
+	chk := keyNum[minisignKeyIDSize+ed25519.PrivateKeySize:]
+
+	hash, err := blake2b.New256(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parseMinisignKey: create checksum: %w", err)
+	}
+
+	hash.Write(raw[:2])
+	hash.Write(keyID)
+	hash.Write(private)
+
+	if !bytes.Equal(hash.Sum(nil), chk) {
+		return nil, errors.New("error parseMinisignKey: secret key checksum mismatch")
+	}
+
+	return &SigningKey{
+		format:  SignatureFormatMinisign,
+		private: private,
+		keyID:   keyID,
+	}, nil
+}
+
+// lastLine returns the last non empty line of b
+// key and signature files start with an untrusted comment.
+func lastLine(b []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// KeyID returns the public key id in upper case hex
+// the same way minisign displays it.
+func (k *SigningKey) KeyID() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.keyID))
+}
+
+// SignaturePath returns the path of the detached signature of archive.
+func (k *SigningKey) SignaturePath(archive string) string {
+	if k.format == SignatureFormatMinisign {
+		return archive + ".minisig"
+	}
+
+	return archive + ".sig"
+}
+
+// Sign returns the detached signature of the content b of the archive name.
+func (k *SigningKey) Sign(name string, b []byte) []byte {
+	if k.format == SignatureFormatEd25519 {
+		sig := ed25519.Sign(k.private, b)
+
+		return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+	}
+
+	digest := blake2b.Sum512(b)
+	sig := ed25519.Sign(k.private, digest[:])
+
+	sigStruct := make([]byte, 0, minisignSignatureSize)
+	sigStruct = append(sigStruct, minisignAlgHashed...)
+	sigStruct = append(sigStruct, k.keyID...)
+	sigStruct = append(sigStruct, sig...)
+
+	trustedComment := fmt.Sprintf("timestamp:%d\tfile:%s\thashed",
+		time.Now().Unix(), filepath.Base(name))
+
+	globalSig := ed25519.Sign(k.private, append(bytes.Clone(sig), trustedComment...))
+
+	out := new(bytes.Buffer)
+
+	fmt.Fprintf(out, "untrusted comment: signature from minisign secret key %s\n", k.KeyID())
+	fmt.Fprintf(out, "%s\n", base64.StdEncoding.EncodeToString(sigStruct))
+	fmt.Fprintf(out, "trusted comment: %s\n", trustedComment)
+	fmt.Fprintf(out, "%s\n", base64.StdEncoding.EncodeToString(globalSig))
+
+	return out.Bytes()
+}
+
+// Verify checks that signature is a valid detached signature of b.
+func (k *SigningKey) Verify(b, signature []byte) error {
+	return k.VerifyReader(bytes.NewReader(b), signature)
+}
+
+// VerifyReader checks that signature is a valid detached signature of the
+// content read from r, hashed minisign signatures are checked while reading r,
+// ed25519 and legacy minisign signatures sign the whole content and read it in memory.
+func (k *SigningKey) VerifyReader(r io.Reader, signature []byte) error {
+	public, ok := k.private.Public().(ed25519.PublicKey)
+	if !ok {
+		return errors.New("error VerifyReader: invalid public key")
+	}
+
+	if k.format == SignatureFormatEd25519 {
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("error VerifyReader: decode signature: %w", err)
+		}
+
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("error VerifyReader: read content: %w", err)
+		}
+
+		if !ed25519.Verify(public, b, sig) {
+			return errors.New("error VerifyReader: signature does not match")
+		}
+
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) != 4 {
+		return errors.New("error VerifyReader: malformed minisign signature")
+	}
+
+	sigStruct, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sigStruct) != minisignSignatureSize {
+		return errors.New("error VerifyReader: malformed minisign signature")
+	}
+
+	if !bytes.Equal(sigStruct[2:2+minisignKeyIDSize], k.keyID) {
+		return errors.New("error VerifyReader: signature was made with another key")
+	}
+
+	sig := sigStruct[2+minisignKeyIDSize:]
+
+	var message []byte
+
+	switch {
+	case bytes.Equal(sigStruct[:2], minisignAlgHashed):
+		hash, err := blake2b.New512(nil)
+		if err != nil {
+			return fmt.Errorf("error VerifyReader: create hash: %w", err)
+		}
+
+		if _, err := io.Copy(hash, r); err != nil {
+			return fmt.Errorf("error VerifyReader: read content: %w", err)
+		}
+
+		message = hash.Sum(nil)
+	case bytes.Equal(sigStruct[:2], minisignAlgEd):
+		message, err = io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("error VerifyReader: read content: %w", err)
+		}
+	default:
+		return errors.New("error VerifyReader: unsupported signature algorithm")
+	}
+
+	if !ed25519.Verify(public, message, sig) {
+		return errors.New("error VerifyReader: signature does not match")
+	}
+
+	trustedComment, ok := strings.CutPrefix(strings.TrimSpace(lines[2]), "trusted comment: ")
+	if !ok {
+		return errors.New("error VerifyReader: malformed trusted comment")
+	}
+
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return fmt.Errorf("error VerifyReader: decode global signature: %w", err)
+	}
+
+	if !ed25519.Verify(public, append(bytes.Clone(sig), trustedComment...), globalSig) {
+		return errors.New("error VerifyReader: trusted comment signature does not match")
+	}
+
+	return nil
+}
+
+// SignFile writes the detached signature of archive next to it
+// and returns the signature and its path.
+func (k *SigningKey) SignFile(archive string, mode os.FileMode) ([]byte, string, error) {
+	b, err := os.ReadFile(archive)
+	if err != nil {
+		return nil, "", fmt.Errorf("error SignFile: read %s: %w", archive, err)
+	}
+
+	sig := k.Sign(archive, b)
+
+	sigPath := k.SignaturePath(archive)
+
+	if err := os.WriteFile(sigPath, sig, mode); err != nil {
+		return nil, "", fmt.Errorf("error SignFile: write %s: %w", sigPath, err)
+	}
+
+	return sig, sigPath, nil
+}
+
+// VerifyFile checks the detached signature sigPath of archive.
+func (k *SigningKey) VerifyFile(archive, sigPath string) error {
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("error VerifyFile: read %s: %w", sigPath, err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("error VerifyFile: open %s: %w", archive, err)
+	}
+
+	defer f.Close()
+
+	return k.VerifyReader(f, sig)
+}
@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+func newEd25519PEM(t *testing.T) []byte {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+
+	require.Nil(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+
+	require.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// newMinisignKey builds an unencrypted minisign secret key file.
+func newMinisignKey(t *testing.T) []byte {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+
+	require.Nil(t, err)
+
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	raw := make([]byte, 0, minisignSecretKeySize)
+	raw = append(raw, minisignAlgEd...)
+	raw = append(raw, 0, 0)
+	raw = append(raw, minisignChkBlake2b...)
+	raw = append(raw, make([]byte, 48)...)
+	raw = append(raw, keyID...)
+	raw = append(raw, private...)
+
+	hash, err := blake2b.New256(nil)
+
+	require.Nil(t, err)
+
+	hash.Write(minisignAlgEd)
+	hash.Write(keyID)
+	hash.Write(private)
+
+	raw = append(raw, hash.Sum(nil)...)
+
+	return []byte("untrusted comment: minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n")
+}
+
+func TestSigningKey_SignFile(t *testing.T) {
+	testCases := []struct {
+		format string
+		key    func(*testing.T) []byte
+		ext    string
+	}{
+		{format: SignatureFormatEd25519, key: newEd25519PEM, ext: ".sig"},
+		{format: SignatureFormatMinisign, key: newMinisignKey, ext: ".minisig"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.format, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "test.zip")
+
+			require.Nil(t, os.WriteFile(archive, byteInput, 0o644))
+
+			key, err := ParseSigningKey(testCase.format, testCase.key(t))
+
+			require.Nil(t, err)
+
+			assert.Len(t, key.KeyID(), 16)
+
+			_, sigPath, err := key.SignFile(archive, 0o644)
+
+			require.Nil(t, err)
+
+			assert.Equal(t, archive+testCase.ext, sigPath)
+
+			assert.Nil(t, key.VerifyFile(archive, sigPath))
+
+			sig, err := os.ReadFile(sigPath)
+
+			require.Nil(t, err)
+
+			parts, err := SplitArchive(context.Background(), archive, int64(len(byteInput)/3+1), 0o644)
+
+			require.Nil(t, err)
+
+			r, err := OpenParts(parts)
+
+			require.Nil(t, err)
+
+			assert.Nil(t, errors.Join(key.VerifyReader(r, sig), r.Close()))
+
+			require.Nil(t, os.WriteFile(archive, []byte("tampered"), 0o644))
+
+			assert.NotNil(t, key.VerifyFile(archive, sigPath))
+		})
+	}
+}
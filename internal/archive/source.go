@@ -0,0 +1,263 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1f, 0x8b}
+	bzip2Magic    = []byte("BZh")
+)
+
+// zip64 extended information extra field header id.
+const zipExtraZip64 = 0x0001
+
+// SourceFilter selects the entries copied from a source archive.
+type SourceFilter struct {
+	// path.Match patterns of the entries to copy, every entry if empty
+	Include []string
+	// path.Match patterns of the entries to skip
+	Exclude []string
+	// directory the copied entries are placed under
+	Prefix string
+}
+
+// ValidatePattern reports whether pattern is a valid path.Match pattern.
+func ValidatePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("error ValidatePattern: %s: %w", pattern, err)
+	}
+
+	return nil
+}
+
+// matchPattern reports whether name matches pattern
+// or is inside a directory matching it.
+func matchPattern(pattern, name string) bool {
+	for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), p); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *SourceFilter) match(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, p := range f.Exclude {
+		if matchPattern(p, name) {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+
+	for _, p := range f.Include {
+		if matchPattern(p, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// target returns the path of the entry name in the output archive.
+func (f *SourceFilter) target(name string) string {
+	if f == nil || f.Prefix == "" {
+		return name
+	}
+
+	return path.Join(f.Prefix, name)
+}
+
+// sourceEntry is a regular file of a source archive.
+type sourceEntry struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	// open returns the uncompressed content, for tar sources
+	// it is only valid until the walk moves to the next entry.
+	open func() (io.ReadCloser, error)
+	// set for zip sources, lets zip archives copy the compressed data.
+	zipFile *zip.File
+}
+
+// walkSourceArchive calls fn for every regular file of the zip, tar,
+// tar.gz or tar.bz2 archive src selected by filter, in archive order.
+func walkSourceArchive(ctx context.Context, src string, filter *SourceFilter,
+	fn func(e *sourceEntry) error,
+) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error walkSourceArchive: open %s: %w", src, err)
+	}
+
+	defer f.Close()
+
+	magic := make([]byte, 4)
+
+	n, err := io.ReadFull(f, magic)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error walkSourceArchive: read %s: %w", src, err)
+	}
+
+	magic = magic[:n]
+
+	if bytes.HasPrefix(magic, zipMagic) || bytes.HasPrefix(magic, zipEmptyMagic) {
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("error walkSourceArchive: get info %s: %w", src, err)
+		}
+
+		return walkZipSource(ctx, f, info.Size(), filter, fn)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error walkSourceArchive: seek %s: %w", src, err)
+	}
+
+	var r io.Reader = bufio.NewReader(f)
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("error walkSourceArchive: decompress %s: %w", src, err)
+		}
+
+		defer gr.Close()
+
+		r = gr
+	case bytes.HasPrefix(magic, bzip2Magic):
+		r = bzip2.NewReader(r)
+	}
+
+	return walkTarSource(ctx, r, filter, fn)
+}
+
+func walkZipSource(ctx context.Context, r io.ReaderAt, size int64, filter *SourceFilter,
+	fn func(e *sourceEntry) error,
+) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("error walkZipSource: read zip: %w", err)
+	}
+
+	for _, zf := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := sourceEntryName(zf.Name)
+
+		if !zf.Mode().IsRegular() || name == "" || !filter.match(name) {
+			continue
+		}
+
+		err := fn(&sourceEntry{
+			name:    name,
+			size:    int64(zf.UncompressedSize64),
+			mode:    zf.Mode().Perm(),
+			modTime: zf.Modified,
+			open:    zf.Open,
+			zipFile: zf,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkTarSource(ctx context.Context, r io.Reader, filter *SourceFilter,
+	fn func(e *sourceEntry) error,
+) error {
+	tr := tar.NewReader(r)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("error walkTarSource: read tar: %w", err)
+		}
+
+		name := sourceEntryName(header.Name)
+
+		if header.Typeflag != tar.TypeReg || name == "" || !filter.match(name) {
+			continue
+		}
+
+		err = fn(&sourceEntry{
+			name:    name,
+			size:    header.Size,
+			mode:    os.FileMode(header.Mode).Perm(),
+			modTime: header.ModTime,
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(tr), nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sourceEntryName cleans the name of a source archive entry and strips its
+// leading / and ../ so it can not point outside of the archive, like entryPath.
+func sourceEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// stripZip64Extra removes the zip64 extra field from extra
+// the zip writer adds its own when the copied entry needs it.
+func stripZip64Extra(extra []byte) []byte {
+	out := make([]byte, 0, len(extra))
+
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+
+		if len(extra) < 4+size {
+			break
+		}
+
+		if id != zipExtraZip64 {
+			out = append(out, extra[:4+size]...)
+		}
+
+		extra = extra[4+size:]
+	}
+
+	return out
+}
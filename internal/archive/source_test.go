@@ -0,0 +1,295 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sourceEntries = []struct {
+	name    string
+	content string
+}{
+	{name: "python/lib/a.py", content: "a"},
+	{name: "python/lib/README.md", content: "readme"},
+	{name: "bin/tool", content: "tool"},
+}
+
+func writeSourceZip(t *testing.T, name string) {
+	t.Helper()
+
+	f, err := os.Create(name)
+
+	require.Nil(t, err)
+
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	_, err = zw.Create("python/")
+
+	require.Nil(t, err)
+
+	for _, e := range sourceEntries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Store})
+
+		require.Nil(t, err)
+
+		_, err = w.Write([]byte(e.content))
+
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, zw.Close())
+}
+
+func writeSourceTarGz(t *testing.T, name string) {
+	t.Helper()
+
+	f, err := os.Create(name)
+
+	require.Nil(t, err)
+
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	for _, e := range sourceEntries {
+		require.Nil(t, tw.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Mode:     0o755,
+			Size:     int64(len(e.content)),
+			Typeflag: tar.TypeReg,
+		}))
+
+		_, err := tw.Write([]byte(e.content))
+
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, errors.Join(tw.Close(), gw.Close()))
+}
+
+func TestMergeArchive(t *testing.T) {
+	dir := t.TempDir()
+
+	sources := map[string]string{
+		"zip":    filepath.Join(dir, "vendor.zip"),
+		"tar.gz": filepath.Join(dir, "vendor.tar.gz"),
+	}
+
+	writeSourceZip(t, sources["zip"])
+	writeSourceTarGz(t, sources["tar.gz"])
+
+	filter := &SourceFilter{
+		Include: []string{"python"},
+		Exclude: []string{"python/lib/*.md"},
+		Prefix:  "layer",
+	}
+
+	for _, archType := range []string{"zip", "tar.gz"} {
+		for srcType, src := range sources {
+			t.Run(srcType+" to "+archType, func(t *testing.T) {
+				name := filepath.Join(t.TempDir(), "test."+archType)
+
+				a := GetArchiver(archType)
+
+				require.Nil(t, a.Open(context.Background(), name))
+
+				err := errors.Join(a.MergeArchive(context.Background(), src, filter),
+					a.Close(context.Background()))
+
+				require.Nil(t, err)
+
+				names, contents := readArchive(t, archType, name)
+
+				assert.Equal(t, []string{"layer/python/lib/a.py"}, names)
+				assert.Equal(t, [][]byte{[]byte("a")}, contents)
+			})
+		}
+	}
+}
+
+func TestZipArchiver_MergeArchiveRaw(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "vendor.zip")
+	name := filepath.Join(dir, "test.zip")
+
+	writeSourceZip(t, src)
+
+	a := &ZipArchiver{}
+
+	require.Nil(t, a.Open(context.Background(), name))
+
+	err := errors.Join(a.MergeArchive(context.Background(), src, nil),
+		a.Close(context.Background()))
+
+	require.Nil(t, err)
+
+	reader, err := zip.OpenReader(name)
+
+	require.Nil(t, err)
+
+	defer reader.Close()
+
+	require.Len(t, reader.File, len(sourceEntries))
+
+	for i, f := range reader.File {
+		assert.Equal(t, sourceEntries[i].name, f.Name)
+		// stored entries stay stored, nothing is recompressed.
+		assert.Equal(t, zip.Store, f.Method)
+	}
+
+	require.Len(t, a.entries, len(sourceEntries))
+}
+
+func TestMergeArchive_FailingEntry(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "vendor.zip")
+
+	f, err := os.Create(src)
+
+	require.Nil(t, err)
+
+	zw := zip.NewWriter(f)
+
+	// the deflated data holds half of the declared size, reading it fails.
+	var data bytes.Buffer
+
+	fw, err := flate.NewWriter(&data, flate.DefaultCompression)
+
+	require.Nil(t, err)
+
+	_, err = fw.Write(bytes.Repeat([]byte("a"), 500))
+
+	require.Nil(t, errors.Join(err, fw.Close()))
+
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "broken.txt",
+		Method:             zip.Deflate,
+		CompressedSize64:   uint64(data.Len()),
+		UncompressedSize64: 1000,
+	})
+
+	require.Nil(t, err)
+
+	_, err = w.Write(data.Bytes())
+
+	require.Nil(t, err)
+
+	w, err = zw.Create("ok.txt")
+
+	require.Nil(t, err)
+
+	_, err = w.Write([]byte("ok"))
+
+	require.Nil(t, errors.Join(err, zw.Close(), f.Close()))
+
+	for _, archType := range []string{"zip", "tar.gz"} {
+		t.Run(archType, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test."+archType)
+
+			a := GetArchiver(archType)
+
+			require.Nil(t, a.Open(context.Background(), name))
+
+			err := errors.Join(a.MergeArchive(context.Background(), src, nil),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			require.Len(t, a.Stats().Skipped, 1)
+			assert.Equal(t, src+":broken.txt", a.Stats().Skipped[0].Path)
+
+			require.Len(t, a.Entries(), 1)
+			assert.Equal(t, "ok.txt", a.Entries()[0].Path)
+
+			names, contents := readArchive(t, archType, name)
+
+			assert.Equal(t, "ok.txt", names[len(names)-1])
+			assert.Equal(t, []byte("ok"), contents[len(contents)-1])
+		})
+	}
+}
+
+func TestMergeArchive_UnsafeNames(t *testing.T) {
+	dir := t.TempDir()
+
+	sources := map[string]string{
+		"zip":    filepath.Join(dir, "vendor.zip"),
+		"tar.gz": filepath.Join(dir, "vendor.tar.gz"),
+	}
+
+	names := []string{"../escape.txt", "/abs.txt", "lib/../../up.txt"}
+
+	f, err := os.Create(sources["zip"])
+
+	require.Nil(t, err)
+
+	zw := zip.NewWriter(f)
+
+	for _, name := range names {
+		w, err := zw.Create(name)
+
+		require.Nil(t, err)
+
+		_, err = w.Write([]byte(name))
+
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, errors.Join(zw.Close(), f.Close()))
+
+	f, err = os.Create(sources["tar.gz"])
+
+	require.Nil(t, err)
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	for _, name := range names {
+		require.Nil(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(name)),
+			Typeflag: tar.TypeReg,
+		}))
+
+		_, err := tw.Write([]byte(name))
+
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, errors.Join(tw.Close(), gw.Close(), f.Close()))
+
+	for _, archType := range []string{"zip", "tar.gz"} {
+		for srcType, src := range sources {
+			t.Run(srcType+" to "+archType, func(t *testing.T) {
+				name := filepath.Join(t.TempDir(), "test."+archType)
+
+				a := GetArchiver(archType)
+
+				require.Nil(t, a.Open(context.Background(), name))
+
+				err := errors.Join(a.MergeArchive(context.Background(), src, &SourceFilter{Prefix: "vendor"}),
+					a.Close(context.Background()))
+
+				require.Nil(t, err)
+
+				written, _ := readArchive(t, archType, name)
+
+				assert.Equal(t, []string{"vendor/escape.txt", "vendor/abs.txt", "vendor/up.txt"}, written)
+			})
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// size of a tar block, headers and contents are padded to it.
+	tarBlockSize = 512
+	// offset and length of the typeflag and checksum of a tar header block.
+	tarTypeflagOffset = 156
+	tarChksumOffset   = 148
+	tarChksumLength   = 8
+)
+
+// SparseSettings selects how files with holes are written to tar archives.
+type SparseSettings struct {
+	// hash the content of sparse entries, holes included, for Entries
+	// hashing every zero of a mostly empty file takes as long as reading it
+	Hashes bool
+}
+
+// sparseFragment is a range of a file holding data, the rest are holes.
+type sparseFragment struct {
+	offset int64
+	length int64
+}
+
+// zeroReader reads zeros, the content of the holes of a sparse file.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+
+	return len(p), nil
+}
+
+// writeSparse writes the file f described by header as a PAX 1.0 sparse
+// entry holding only its data fragments, archive/tar can read such entries
+// but not write them, so the header blocks are encoded here.
+func (t *TarArchiver) writeSparse(ctx context.Context, f *os.File, header *tar.Header,
+	fragments []sparseFragment,
+) error {
+	var sparseMap bytes.Buffer
+
+	sparseMap.WriteString(strconv.Itoa(len(fragments)) + "\n")
+
+	size := int64(0)
+
+	for _, fr := range fragments {
+		sparseMap.WriteString(fmt.Sprintf("%d\n%d\n", fr.offset, fr.length))
+
+		size += fr.length
+	}
+
+	sparseMap.Write(make([]byte, blockPadding(int64(sparseMap.Len()))))
+
+	size += int64(sparseMap.Len())
+
+	blocks, err := sparseHeaderBlocks(header, size)
+	if err != nil {
+		return fmt.Errorf("error writeSparse: encode header %s: %w", header.Name, err)
+	}
+
+	// pads the previous entry, the blocks are then written past the tar writer.
+	if err := t.tarWriter.Flush(); err != nil {
+		return fmt.Errorf("error writeSparse: flush tar: %w", err)
+	}
+
+	if _, err := t.gzipWriter.Write(append(blocks, sparseMap.Bytes()...)); err != nil {
+		return fmt.Errorf("error writeSparse: write header %s: %w", header.Name, err)
+	}
+
+	// without hashes, sparse entries are listed in Entries without SHA256.
+	var sum hash.Hash
+
+	if t.settings.Sparse.Hashes {
+		sum = sha256.New()
+	}
+
+	hashes := io.Writer(io.Discard)
+	if sum != nil {
+		hashes = sum
+	}
+
+	end := int64(0)
+
+	for _, fr := range fragments {
+		if err := hashHole(sum, fr.offset-end); err != nil {
+			return err
+		}
+
+		if _, err := f.Seek(fr.offset, io.SeekStart); err != nil {
+			return fmt.Errorf("error writeSparse: seek %s: %w", f.Name(), err)
+		}
+
+		w := io.MultiWriter(t.gzipWriter, hashes)
+
+		n, err := copyWithContext(ctx, w, io.LimitReader(f, fr.length))
+		if err != nil {
+			return fmt.Errorf("error writeSparse: write to tar: %w", err)
+		}
+
+		// the file shrank since its holes were found, zeros keep the entry size.
+		if _, err := io.CopyN(w, zeroReader{}, fr.length-n); err != nil {
+			return fmt.Errorf("error writeSparse: write to tar: %w", err)
+		}
+
+		end = fr.offset + fr.length
+	}
+
+	if err := hashHole(sum, header.Size-end); err != nil {
+		return err
+	}
+
+	if _, err := t.gzipWriter.Write(make([]byte, blockPadding(size))); err != nil {
+		return fmt.Errorf("error writeSparse: pad %s: %w", header.Name, err)
+	}
+
+	t.record(header.Name, header.Size, os.FileMode(header.Mode), sum)
+
+	return nil
+}
+
+// hashHole writes size zeros to sum, if sum is set.
+func hashHole(sum hash.Hash, size int64) error {
+	if sum == nil {
+		return nil
+	}
+
+	if _, err := io.CopyN(sum, zeroReader{}, size); err != nil {
+		return fmt.Errorf("error hashHole: %w", err)
+	}
+
+	return nil
+}
+
+// sparseHeaderBlocks encodes the PAX extended header and the USTAR header
+// of a sparse entry whose encoded content is size bytes long, every field
+// USTAR can not hold is stored in the extended header.
+func sparseHeaderBlocks(header *tar.Header, size int64) ([]byte, error) {
+	records := map[string]string{
+		"GNU.sparse.major":    "1",
+		"GNU.sparse.minor":    "0",
+		"GNU.sparse.name":     header.Name,
+		"GNU.sparse.realsize": strconv.FormatInt(header.Size, 10),
+		"size":                strconv.FormatInt(size, 10),
+		"mtime":               strconv.FormatInt(header.ModTime.Unix(), 10),
+		"uid":                 strconv.Itoa(header.Uid),
+		"gid":                 strconv.Itoa(header.Gid),
+	}
+
+	if header.Uname != "" {
+		records["uname"] = header.Uname
+	}
+
+	if header.Gname != "" {
+		records["gname"] = header.Gname
+	}
+
+	for k, v := range header.PAXRecords {
+		records[k] = v
+	}
+
+	var pax strings.Builder
+
+	for _, k := range slices.Sorted(maps.Keys(records)) {
+		pax.WriteString(paxRecord(k, records[k]))
+	}
+
+	dir, file := path.Split(header.Name)
+
+	paxHeader, err := ustarBlock(&tar.Header{
+		Name:     asciiName(path.Join(dir, "PaxHeaders.0", file), 100),
+		Mode:     0o644,
+		Size:     int64(pax.Len()),
+		ModTime:  time.Unix(0, 0),
+		Typeflag: tar.TypeReg,
+	}, tar.TypeXHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	// the real values are in the extended header, these only fit USTAR.
+	sparseHeader, err := ustarBlock(&tar.Header{
+		Name:     asciiName(path.Join(dir, "GNUSparseFile.0", file), 100),
+		Mode:     header.Mode,
+		Size:     min(size, 0o77777777777),
+		ModTime:  time.Unix(0, 0),
+		Typeflag: tar.TypeReg,
+	}, tar.TypeReg)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := append(paxHeader, pax.String()...)
+	blocks = append(blocks, make([]byte, blockPadding(int64(pax.Len())))...)
+
+	return append(blocks, sparseHeader...), nil
+}
+
+// ustarBlock encodes header as a USTAR header block with typeflag.
+func ustarBlock(header *tar.Header, typeflag byte) ([]byte, error) {
+	var b bytes.Buffer
+
+	header.Format = tar.FormatUSTAR
+
+	// the header block is written as soon as the header is.
+	if err := tar.NewWriter(&b).WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	block := b.Bytes()[:tarBlockSize]
+	block[tarTypeflagOffset] = typeflag
+
+	chksum := block[tarChksumOffset : tarChksumOffset+tarChksumLength]
+	copy(chksum, "        ")
+
+	sum := 0
+	for _, c := range block {
+		sum += int(c)
+	}
+
+	copy(chksum, fmt.Sprintf("%06o\x00 ", sum))
+
+	return block, nil
+}
+
+// paxRecord formats a PAX record, prefixed by its own length.
+func paxRecord(k, v string) string {
+	record := " " + k + "=" + v + "\n"
+	size := len(record) + len(strconv.Itoa(len(record)))
+
+	if len(strconv.Itoa(size)) > len(strconv.Itoa(len(record))) {
+		size++
+	}
+
+	return strconv.Itoa(size) + record
+}
+
+// asciiName returns name with its non ASCII bytes replaced,
+// keeping its last n bytes at most.
+func asciiName(name string, n int) string {
+	b := []byte(name)
+
+	for i, c := range b {
+		if c >= 0x80 {
+			b[i] = '_'
+		}
+	}
+
+	return string(b[max(0, len(b)-n):])
+}
+
+// blockPadding returns the bytes padding size to a tar block.
+func blockPadding(size int64) int64 {
+	return -size & (tarBlockSize - 1)
+}
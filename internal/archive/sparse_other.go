@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package archive
+
+import "os"
+
+// sparseFragments returns no fragment where holes can not be found,
+// sparse files are written in full.
+func sparseFragments(_ *os.File, _ int64) ([]sparseFragment, error) {
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarArchiver_Sparse(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "disk.img")
+
+	f, err := os.Create(src)
+
+	require.Nil(t, err)
+
+	_, err = f.WriteAt([]byte("head"), 0)
+	require.Nil(t, err)
+
+	_, err = f.WriteAt([]byte("middle"), 32<<20)
+	require.Nil(t, err)
+
+	require.Nil(t, f.Truncate(64<<20))
+
+	fragments, err := sparseFragments(f, 64<<20)
+
+	require.Nil(t, errors.Join(err, f.Close()))
+
+	if fragments == nil {
+		t.Skip("holes can not be found on this file system")
+	}
+
+	content, err := os.ReadFile(src)
+
+	require.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		opts   []Options
+		sparse bool
+		sha256 string
+	}{
+		{name: "full", sha256: fmt.Sprintf("%x", sha256.Sum256(content))},
+		{name: "sparse", opts: []Options{WithSparse(true)}, sparse: true, sha256: fmt.Sprintf("%x", sha256.Sum256(content))},
+		{name: "sparse_no_hashes", opts: []Options{WithSparse(false)}, sparse: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name+".tar.gz")
+
+			a := GetArchiver("tar.gz")
+
+			require.Nil(t, a.Open(context.Background(), name, tt.opts...))
+
+			err := errors.Join(a.ArchiveFile(context.Background(), src, "images/disk.img"),
+				a.ArchiveContent(context.Background(), []byte("content"), "content.txt", DefaultContentMode),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			require.Len(t, a.Entries(), 2)
+
+			assert.Equal(t, int64(len(content)), a.Entries()[0].Size)
+			assert.Equal(t, tt.sha256, a.Entries()[0].SHA256)
+
+			f, err := os.Open(name)
+
+			require.Nil(t, err)
+
+			defer f.Close()
+
+			gr, err := gzip.NewReader(f)
+
+			require.Nil(t, err)
+
+			r := tar.NewReader(gr)
+
+			h, err := r.Next()
+
+			require.Nil(t, err)
+
+			assert.Equal(t, "images/disk.img", h.Name)
+			assert.Equal(t, int64(len(content)), h.Size)
+
+			if tt.sparse {
+				assert.Equal(t, "1", h.PAXRecords["GNU.sparse.major"])
+			} else {
+				assert.Empty(t, h.PAXRecords)
+			}
+
+			b, err := io.ReadAll(r)
+
+			require.Nil(t, err)
+
+			assert.Equal(t, content, b)
+
+			h, err = r.Next()
+
+			require.Nil(t, err)
+
+			assert.Equal(t, "content.txt", h.Name)
+
+			_, err = r.Next()
+
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
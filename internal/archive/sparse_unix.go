@@ -0,0 +1,65 @@
+//go:build linux || darwin
+
+package archive
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// sparseFragments returns the data fragments of f found with SEEK_DATA
+// and SEEK_HOLE, nil if f has no hole or its file system can not find them.
+func sparseFragments(f *os.File, size int64) ([]sparseFragment, error) {
+	if size == 0 {
+		return nil, nil
+	}
+
+	fragments := make([]sparseFragment, 0)
+
+	for offset := int64(0); offset < size; {
+		data, err := f.Seek(offset, unix.SEEK_DATA)
+		// no data past offset, the file ends with a hole.
+		if errors.Is(err, unix.ENXIO) {
+			break
+		}
+
+		if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		hole, err := f.Seek(data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+
+		hole = min(hole, size)
+
+		if data < hole {
+			fragments = append(fragments, sparseFragment{offset: data, length: hole - data})
+		}
+
+		offset = hole
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if len(fragments) == 1 && fragments[0].length == size {
+		return nil, nil
+	}
+
+	// a trailing empty fragment marks the end of a file ending with a hole.
+	if end := len(fragments) - 1; end == -1 || fragments[end].offset+fragments[end].length < size {
+		fragments = append(fragments, sparseFragment{offset: size})
+	}
+
+	return fragments, nil
+}
@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// special_files policies.
+const (
+	SpecialFilesSkip  = "skip"
+	SpecialFilesWrite = "write"
+)
+
+// ErrSpecialFile is wrapped by the errors of skipped
+// devices, named pipes and sockets.
+var ErrSpecialFile = errors.New("special file")
+
+// special file types, opening them would block or fail.
+const specialTypes = os.ModeDevice | os.ModeCharDevice | os.ModeNamedPipe | os.ModeSocket
+
+// ParseSpecialFiles reports whether the special_files policy name
+// writes special files, skip or write.
+func ParseSpecialFiles(name string) (bool, error) {
+	switch strings.ToLower(name) {
+	case SpecialFilesSkip:
+		return false, nil
+	case SpecialFilesWrite:
+		return true, nil
+	default:
+		return false, fmt.Errorf("error ParseSpecialFiles: unsupported policy %q, only %s and %s are supported",
+			name, SpecialFilesSkip, SpecialFilesWrite)
+	}
+}
+
+// specialFile returns the info of src if it is a device, a named pipe
+// or a socket, nil otherwise, src is classified before being opened.
+func specialFile(src string) (os.FileInfo, error) {
+	info, err := os.Lstat(src)
+	// opening an unresolved symbolic link opens its target.
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		info, err = os.Stat(src)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error specialFile: get info %s: %w", src, err)
+	}
+
+	if info.Mode()&specialTypes == 0 {
+		return nil, nil
+	}
+
+	return info, nil
+}
+
+// specialFileError returns why the special file src is skipped.
+func specialFileError(src string, info os.FileInfo) error {
+	kind := "device"
+
+	switch {
+	case info.Mode()&os.ModeNamedPipe != 0:
+		kind = "named pipe"
+	case info.Mode()&os.ModeSocket != 0:
+		kind = "socket"
+	}
+
+	return fmt.Errorf("error specialFile: %s is a %s: %w", src, kind, ErrSpecialFile)
+}
+
+// writeSpecial writes the header of the device or named pipe src
+// sockets can not be archived, special files are not listed in Entries.
+func (t *TarArchiver) writeSpecial(src, dst string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSocket != 0 {
+		return specialFileError(src, info)
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return fmt.Errorf("error writeSpecial: set header infor: %w", err)
+	}
+
+	header.Name = dst
+	t.setHeader(header)
+
+	header.PAXRecords, err = t.settings.Xattrs.paxRecords(src)
+	if err != nil {
+		return err
+	}
+
+	if err := t.tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writeSpecial: write header %s: %w", dst, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+//go:build linux || darwin
+
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestArchiver_SpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+
+	require.Nil(t, os.MkdirAll(src, 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "file.txt"), []byte("file"), 0o644))
+	require.Nil(t, unix.Mkfifo(filepath.Join(src, "pipe"), 0o644))
+
+	tests := []struct {
+		name     string
+		archType string
+		write    bool
+		expected map[string]byte
+		skipped  []string
+	}{
+		{
+			name:     "tar skip",
+			archType: "tar.gz",
+			expected: map[string]byte{"src/file.txt": tar.TypeReg},
+			skipped:  []string{filepath.Join(src, "pipe"), os.DevNull},
+		},
+		{
+			name:     "tar write",
+			archType: "tar.gz",
+			write:    true,
+			expected: map[string]byte{
+				"src/file.txt": tar.TypeReg,
+				"src/pipe":     tar.TypeFifo,
+				"null":         tar.TypeChar,
+			},
+			skipped: []string{},
+		},
+		{
+			name:     "zip",
+			archType: "zip",
+			write:    true,
+			skipped:  []string{filepath.Join(src, "pipe"), os.DevNull},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, fmt.Sprintf("%d.%s", i, tt.archType))
+
+			a := GetArchiver(tt.archType)
+
+			require.Nil(t, a.Open(context.Background(), name, WithSpecialFiles(tt.write)))
+
+			// a named pipe without writer blocks the archiving if it is opened.
+			require.Nil(t, a.ArchiveDir(context.Background(), src, "src"))
+
+			err := a.ArchiveFile(context.Background(), os.DevNull, "null")
+			if !tt.write || tt.archType == "zip" {
+				assert.ErrorIs(t, err, ErrSpecialFile)
+			}
+
+			require.Nil(t, a.Close(context.Background()))
+
+			skipped := make([]string, 0)
+
+			for _, s := range a.Stats().Skipped {
+				assert.True(t, s.Special, s.Path)
+
+				skipped = append(skipped, s.Path)
+			}
+
+			assert.Equal(t, tt.skipped, skipped)
+			assert.Len(t, a.Entries(), 1)
+
+			if tt.archType == "zip" {
+				return
+			}
+
+			f, err := os.Open(name)
+
+			require.Nil(t, err)
+
+			defer f.Close()
+
+			gr, err := gzip.NewReader(f)
+
+			require.Nil(t, err)
+
+			r := tar.NewReader(gr)
+
+			types := make(map[string]byte)
+
+			for {
+				h, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				require.Nil(t, err)
+
+				types[h.Name] = h.Typeflag
+			}
+
+			assert.Equal(t, tt.expected, types)
+		})
+	}
+}
+
+func TestArchiver_SpecialFilesEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+
+	require.Nil(t, os.MkdirAll(filepath.Join(src, "run"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "file.txt"), []byte("file"), 0o644))
+	require.Nil(t, unix.Mkfifo(filepath.Join(src, "run", "pipe"), 0o644))
+
+	for _, write := range []bool{false, true} {
+		t.Run(fmt.Sprint(write), func(t *testing.T) {
+			name := filepath.Join(dir, fmt.Sprintf("%t.tar.gz", write))
+
+			a := GetArchiver("tar.gz")
+
+			require.Nil(t, a.Open(context.Background(), name, WithDirEntries(false, 0), WithSpecialFiles(write)))
+
+			err := errors.Join(a.ArchiveDir(context.Background(), src, "src"),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			modes := readModes(t, "tar.gz", name)
+
+			// a directory only holding skipped special files is empty.
+			_, ok := modes["src/run/"]
+
+			assert.Equal(t, !write, ok)
+			assert.Equal(t, write, modes["src/run/pipe"] != 0)
+		})
+	}
+}
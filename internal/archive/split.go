@@ -0,0 +1,203 @@
+package archive
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sizePattern = regexp.MustCompile(`^\s*(\d+)\s*([a-zA-Z]*)\s*$`)
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// Part is a volume of a split archive.
+type Part struct {
+	Path   string
+	Size   int64
+	MD5    string
+	SHA256 string
+}
+
+// ParseSize parses a size in bytes with an optional
+// B, KB, MB, GB, KiB, MiB or GiB unit, e.g. 100MiB.
+func ParseSize(s string) (int64, error) {
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("error ParseSize: invalid size %q", s)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(m[2])]
+	if !ok {
+		return 0, fmt.Errorf("error ParseSize: unsupported unit %q", m[2])
+	}
+
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error ParseSize: invalid size %q: %w", s, err)
+	}
+
+	if n == 0 {
+		return 0, fmt.Errorf("error ParseSize: size %q must be positive", s)
+	}
+
+	if n > (1<<63-1)/unit {
+		return 0, fmt.Errorf("error ParseSize: size %q is too big", s)
+	}
+
+	return n * unit, nil
+}
+
+// PartPath returns the path of the volume index, starting at 1, of archive.
+func PartPath(archive string, index int) string {
+	return fmt.Sprintf("%s.%03d", archive, index)
+}
+
+// SplitArchive splits archive into volumes of at most partSize bytes named
+// archive.001, archive.002..., which joined back in order give the archive,
+// zip's native split format (.z01) is not written. the archive is removed once split, the volumes are removed on error.
+// volumes numbered after the last one, left by a previous split giving
+// more volumes, are removed.
+func SplitArchive(ctx context.Context, archive string, partSize int64, mode os.FileMode) ([]Part, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, fmt.Errorf("error SplitArchive: open %s: %w", archive, err)
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error SplitArchive: get info %s: %w", archive, err)
+	}
+
+	parts := make([]Part, 0, info.Size()/partSize+1)
+
+	for i := 1; i == 1 || int64(i-1)*partSize < info.Size(); i++ {
+		part, err := writePart(ctx, io.LimitReader(f, partSize), PartPath(archive, i), mode)
+		if err != nil {
+			return nil, errors.Join(err, RemoveParts(parts))
+		}
+
+		parts = append(parts, part)
+	}
+
+	if err := os.Remove(archive); err != nil {
+		return nil, errors.Join(
+			fmt.Errorf("error SplitArchive: remove %s: %w", archive, err),
+			RemoveParts(parts))
+	}
+
+	if err := removeStaleParts(archive, len(parts)+1); err != nil {
+		return nil, errors.Join(err, RemoveParts(parts))
+	}
+
+	return parts, nil
+}
+
+// removeStaleParts removes the volumes of archive numbered from index
+// until a volume is missing.
+func removeStaleParts(archive string, index int) error {
+	for i := index; ; i++ {
+		name := PartPath(archive, i)
+
+		if err := os.Remove(name); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+
+			return fmt.Errorf("error removeStaleParts: remove %s: %w", name, err)
+		}
+	}
+}
+
+func writePart(ctx context.Context, r io.Reader, name string, mode os.FileMode) (Part, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return Part{}, fmt.Errorf("error writePart: create %s: %w", name, err)
+	}
+
+	md5Sum := md5.New()
+	sha256Sum := sha256.New()
+
+	n, err := copyWithContext(ctx, io.MultiWriter(f, md5Sum, sha256Sum), r)
+	if err = errors.Join(err, f.Close()); err != nil {
+		return Part{}, errors.Join(
+			fmt.Errorf("error writePart: write %s: %w", name, err),
+			removeTmpArchive(name))
+	}
+
+	return Part{
+		Path:   name,
+		Size:   n,
+		MD5:    fmt.Sprintf("%x", md5Sum.Sum(nil)),
+		SHA256: fmt.Sprintf("%x", sha256Sum.Sum(nil)),
+	}, nil
+}
+
+// partsReader reads the volumes of a split archive one after the other.
+type partsReader struct {
+	io.Reader
+	files []*os.File
+}
+
+func (r *partsReader) Close() error {
+	var errs []error
+
+	for _, f := range r.files {
+		errs = append(errs, f.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// OpenParts returns a reader of the archive split into parts
+// reading the volumes in order, closing it closes every volume.
+func OpenParts(parts []Part) (io.ReadCloser, error) {
+	r := &partsReader{files: make([]*os.File, 0, len(parts))}
+	readers := make([]io.Reader, 0, len(parts))
+
+	for _, p := range parts {
+		f, err := os.Open(p.Path)
+		if err != nil {
+			return nil, errors.Join(
+				fmt.Errorf("error OpenParts: open %s: %w", p.Path, err),
+				r.Close())
+		}
+
+		r.files = append(r.files, f)
+		readers = append(readers, f)
+	}
+
+	r.Reader = io.MultiReader(readers...)
+
+	return r, nil
+}
+
+// RemoveParts removes the volumes of a split archive.
+func RemoveParts(parts []Part) error {
+	var errs []error
+
+	for _, p := range parts {
+		if err := os.Remove(p.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("error RemoveParts: remove %s: %w", p.Path, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"100":    100,
+		"10B":    10,
+		"2KB":    2000,
+		"1MiB":   1 << 20,
+		"100MiB": 100 << 20,
+		"1 GiB":  1 << 30,
+	} {
+		n, err := ParseSize(s)
+
+		require.Nil(t, err)
+
+		assert.Equal(t, expected, n, s)
+	}
+
+	for _, s := range []string{"", "0", "-1", "1TiB", "MiB", "1.5MiB"} {
+		_, err := ParseSize(s)
+
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestSplitArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "test.zip")
+	content := bytes.Repeat([]byte("0123456789"), 25)
+
+	require.Nil(t, os.WriteFile(archive, content, 0o644))
+
+	parts, err := SplitArchive(context.Background(), archive, 100, 0o644)
+
+	require.Nil(t, err)
+
+	require.Len(t, parts, 3)
+
+	for i, size := range []int64{100, 100, 50} {
+		assert.Equal(t, PartPath(archive, i+1), parts[i].Path)
+		assert.Equal(t, size, parts[i].Size)
+
+		b, err := os.ReadFile(parts[i].Path)
+
+		require.Nil(t, err)
+
+		sha, err := SHA256(b)
+
+		require.Nil(t, err)
+
+		assert.Equal(t, sha, parts[i].SHA256)
+		assert.Equal(t, MD5(b), parts[i].MD5)
+	}
+
+	_, err = os.Stat(archive)
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	r, err := OpenParts(parts)
+
+	require.Nil(t, err)
+
+	joined, err := io.ReadAll(r)
+
+	require.Nil(t, errors.Join(err, r.Close()))
+
+	assert.Equal(t, content, joined)
+
+	require.Nil(t, RemoveParts(parts))
+
+	_, err = os.Stat(parts[0].Path)
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSplitArchive_RemovesStaleParts(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "test.zip")
+	content := bytes.Repeat([]byte("0123456789"), 25)
+
+	require.Nil(t, os.WriteFile(archive, content, 0o644))
+
+	parts, err := SplitArchive(context.Background(), archive, 50, 0o644)
+
+	require.Nil(t, err)
+
+	require.Len(t, parts, 5)
+
+	require.Nil(t, os.WriteFile(archive, content, 0o644))
+
+	parts, err = SplitArchive(context.Background(), archive, 100, 0o644)
+
+	require.Nil(t, err)
+
+	require.Len(t, parts, 3)
+
+	for _, i := range []int{4, 5} {
+		_, err = os.Stat(PartPath(archive, i))
+
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,53 @@
+package archive
+
+import "errors"
+
+// Skipped is a path which could not be added to an archive.
+type Skipped struct {
+	Path   string
+	Reason string
+	// skipped device, named pipe or socket
+	Special bool
+}
+
+// Stats summarizes what was written to an archive.
+type Stats struct {
+	EntryCount       int
+	UncompressedSize int64
+	ExcludedCount    int
+	Skipped          []Skipped
+}
+
+// exclude counts a path skipped because of the exclude list.
+func (l *entryLog) exclude() {
+	l.excluded++
+}
+
+// skip records a path which failed to be added.
+func (l *entryLog) skip(path string, err error) {
+	l.skipped = append(l.skipped, Skipped{
+		Path:    path,
+		Reason:  err.Error(),
+		Special: errors.Is(err, ErrSpecialFile),
+	})
+}
+
+// skipOnError records path as skipped if err is not a context error
+// and returns err.
+func (l *entryLog) skipOnError(path string, err error) error {
+	if err != nil && !isContextError(err) {
+		l.skip(path, err)
+	}
+
+	return err
+}
+
+// Stats returns the statistics of the entries written so far.
+func (l *entryLog) Stats() Stats {
+	return Stats{
+		EntryCount:       len(l.entries),
+		UncompressedSize: TotalSize(l.entries),
+		ExcludedCount:    l.excluded,
+		Skipped:          l.skipped,
+	}
+}
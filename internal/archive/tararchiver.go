@@ -2,21 +2,23 @@ package archive
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"os"
-	"path/filepath"
-	"slices"
-	"strings"
+	"runtime"
 	"time"
 )
 
 // writeToTar create a new file dst inside the tarball
 // copies src content to the newly created dst file.
-func (t *TarArchiver) writeToTar(src, dst string) error {
+func (t *TarArchiver) writeToTar(ctx context.Context, src, dst string) error {
 	f, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("error writeToTar: open %s: %w", src, err)
@@ -35,147 +37,548 @@ func (t *TarArchiver) writeToTar(src, dst string) error {
 	}
 
 	header.Name = dst
+	t.setHeader(header)
+
+	header.PAXRecords, err = t.settings.Xattrs.paxRecords(src)
+	if err != nil {
+		return err
+	}
+
+	// sparse entries are PAX entries.
+	if t.settings.Sparse != nil && t.settings.TarFormat&^tar.FormatPAX == 0 {
+		fragments, err := sparseFragments(f, info.Size())
+		if err != nil {
+			return fmt.Errorf("error writeToTar: find holes %s: %w", src, err)
+		}
+
+		if fragments != nil {
+			return t.writeSparse(ctx, f, header, fragments)
+		}
+	}
 
 	err = t.tarWriter.WriteHeader(header)
 	if err != nil {
 		return fmt.Errorf("error writeToTar: write header: %w", err)
 	}
 
-	if _, err := io.Copy(t.tarWriter, f); err != nil {
+	sum := sha256.New()
+
+	n, err := copyWithContext(ctx, io.MultiWriter(t.tarWriter, sum), f)
+	if err != nil {
 		return fmt.Errorf("error writeToTar: write to tar: %w", err)
 	}
 
+	t.record(dst, n, os.FileMode(header.Mode), sum)
+
 	return nil
 }
 
 // ArchiveFile accepts an absolute path src  and any other path dst
 // every symbolic link is evaluated if SymLink is set to true
 // call writeToTar, to write src content to dst.
-func (t *TarArchiver) ArchiveFile(src, dst string) error {
-	var err error
+func (t *TarArchiver) ArchiveFile(ctx context.Context, src, dst string) error {
+	return t.skipOnError(src, t.archiveFile(ctx, src, dst))
+}
 
-	if slices.Contains(t.settings.ExcludeList, src) {
-		return nil
+func (t *TarArchiver) archiveFile(ctx context.Context, src, dst string) error {
+	src, excluded, err := resolveSrc(t.settings, src)
+	if err != nil || excluded {
+		if excluded {
+			t.exclude()
+		}
+
+		return err
 	}
 
-	if t.settings.SymLink {
-		src, err = evaluateSymLink(src)
-		if err != nil {
-			return err
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	info, err := specialFile(src)
+	if err != nil {
+		return err
+	}
+
+	if info != nil {
+		if !t.settings.SpecialFiles {
+			return specialFileError(src, info)
 		}
+
+		return t.writeSpecial(src, dst, info)
 	}
 
-	if err := t.writeToTar(src, dst); err != nil {
+	if err := t.writeToTar(ctx, src, dst); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// ArchiveDir accepts an absolute path src  and any other path dst
-// loops recursively through src path and calls ArchiveFile on each encountered file
-// to add it to the tarball
-// every symbolic link is evaluated if SymLink is set to true.
-func (t *TarArchiver) ArchiveDir(src, dst string) error {
-	var err error
+// bufferedTarEntry is a file read ahead of being written to the tarball
+// files bigger than maxBufferedEntrySize are streamed by writeToTar instead.
+type bufferedTarEntry struct {
+	src    string
+	header *tar.Header
+	data   *bytes.Buffer
+	sum    hash.Hash
+	stream bool
+	dir    bool
+	// device and inode of files with several links, see linkIndex
+	id *fileID
+	// set for devices and named pipes, only their header is written
+	special os.FileInfo
+}
 
-	if slices.Contains(t.settings.ExcludeList, src) {
-		return nil
+// readEntry reads the header and content of e into memory.
+func (t *TarArchiver) readEntry(ctx context.Context, e dirEntry) (*bufferedTarEntry, error) {
+	if e.dir {
+		return &bufferedTarEntry{src: e.src, dir: true}, nil
 	}
 
-	if t.settings.SymLink {
-		src, err = evaluateSymLink(src)
-		if err != nil {
-			return err
+	src, excluded, err := resolveSrc(t.settings, e.src)
+	if err != nil || excluded {
+		return nil, err
+	}
+
+	info, err := specialFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if info != nil {
+		if !t.settings.SpecialFiles {
+			return nil, specialFileError(src, info)
 		}
+
+		return &bufferedTarEntry{src: src, special: info}, nil
 	}
 
-	entries, err := os.ReadDir(src)
+	f, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("error ArchiveDir: read dirs under %s: %w", src, err)
+		return nil, fmt.Errorf("error readEntry: open %s: %w", src, err)
 	}
 
-	for _, entry := range entries {
-		tmpPath := filepath.Join(src, entry.Name())
+	defer f.Close()
 
-		if !entry.IsDir() {
-			relPathIndex := strings.Index(tmpPath, dst)
-			fPath := tmpPath
+	info, err = f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error readEntry: get info %s: %w", src, err)
+	}
 
-			if relPathIndex != -1 {
-				fPath = tmpPath[relPathIndex:]
-			}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, fmt.Errorf("error readEntry: set header infor: %w", err)
+	}
 
-			if err := t.ArchiveFile(tmpPath, fPath); err != nil {
-				log.Printf("error ArchiveDir: write to zip %s: %s", tmpPath, err)
-			}
+	header.Name = e.dst
+
+	header.PAXRecords, err = t.settings.Xattrs.paxRecords(src)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bufferedTarEntry{src: src, header: header}
+
+	if t.links != nil {
+		b.id = linkedFileID(info)
+	}
+
+	if info.Size() > maxBufferedEntrySize {
+		b.stream = true
+
+		return b, nil
+	}
+
+	b.data = bytes.NewBuffer(make([]byte, 0, info.Size()))
+	b.sum = sha256.New()
+
+	if _, err := copyWithContext(ctx, io.MultiWriter(b.data, b.sum), f); err != nil {
+		return nil, fmt.Errorf("error readEntry: read %s: %w", src, err)
+	}
+
+	// the file changed between Stat and reading it.
+	header.Size = int64(b.data.Len())
+
+	return b, nil
+}
+
+// writeEntry writes an entry read by readEntry to the tarball
+// failing entries are logged and skipped, only context errors are returned.
+func (t *TarArchiver) writeEntry(ctx context.Context, e dirEntry,
+	b *bufferedTarEntry, err error,
+) error {
+	if err == nil && b == nil {
+		t.exclude()
+	}
+
+	if err == nil && b != nil {
+		if b.dir {
+			err = t.writeDir(e)
+		} else if b.special != nil {
+			err = t.writeSpecial(b.src, e.dst, b.special)
 		} else {
-			if err := t.ArchiveDir(tmpPath, dst); err != nil {
-				log.Printf("error ArchiveDir: write to zip %s: %s", tmpPath, err)
-			}
+			err = t.writeFileEntry(ctx, e, b)
+		}
+	}
+
+	if err != nil {
+		if isContextError(err) {
+			return err
+		}
+
+		log.Printf("error ArchiveDir: write to tar %s: %s", e.src, err)
+
+		t.skip(e.src, err)
+	}
+
+	return nil
+}
+
+// writeFileEntry writes b as a hard link to an earlier entry sharing
+// its inode or content, or writes its content otherwise, streamed files
+// are hashed while written, and read twice only if an earlier file has
+// their size.
+func (t *TarArchiver) writeFileEntry(ctx context.Context, e dirEntry, b *bufferedTarEntry) error {
+	t.setHeader(b.header)
+
+	var (
+		sum string
+		err error
+	)
+
+	if b.sum != nil {
+		sum = fmt.Sprintf("%x", b.sum.Sum(nil))
+	} else if t.links.hashAhead(b) {
+		sum, err = fileSHA256(ctx, b.src)
+		if err != nil {
+			return err
 		}
 	}
 
+	if target, ok := t.links.target(b, sum); ok {
+		if err := t.writeLink(b.header, target); err != nil {
+			return err
+		}
+
+		t.links.add(b, target)
+
+		return nil
+	}
+
+	if b.stream {
+		err = t.writeToTar(ctx, b.src, e.dst)
+	} else {
+		err = t.writeBuffered(b)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	t.links.add(b, t.entries[len(t.entries)-1])
+
+	return nil
+}
+
+// writeDir writes the directory entry e, directories are not listed in Entries.
+func (t *TarArchiver) writeDir(e dirEntry) error {
+	header := &tar.Header{
+		Name:     e.dst + "/",
+		Mode:     int64(e.mode.Perm()),
+		ModTime:  e.modTime,
+		Typeflag: tar.TypeDir,
+	}
+
+	t.setHeader(header)
+
+	records, err := t.settings.Xattrs.paxRecords(e.src)
+	if err != nil {
+		return err
+	}
+
+	header.PAXRecords = records
+
+	if err := t.tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writeDir: write header %s: %w", header.Name, err)
+	}
+
 	return nil
 }
 
-func (t *TarArchiver) ArchiveContent(src []byte, dst string) error {
-	err := t.tarWriter.WriteHeader(&tar.Header{
+func (t *TarArchiver) writeBuffered(b *bufferedTarEntry) error {
+	t.setHeader(b.header)
+
+	if err := t.tarWriter.WriteHeader(b.header); err != nil {
+		return fmt.Errorf("error writeBuffered: write header: %w", err)
+	}
+
+	if _, err := b.data.WriteTo(t.tarWriter); err != nil {
+		return fmt.Errorf("error writeBuffered: write to tar: %w", err)
+	}
+
+	t.record(b.header.Name, b.header.Size, os.FileMode(b.header.Mode), b.sum)
+
+	return nil
+}
+
+// ArchiveDir accepts an absolute path src  and any other path dst
+// loops recursively through src path and adds each encountered file to the tarball
+// files are read by Concurrency workers, but written in lexical order
+// every symbolic link is evaluated if SymLink is set to true.
+func (t *TarArchiver) ArchiveDir(ctx context.Context, src, dst string) error {
+	entries, err := collectDirEntries(ctx, t.settings, &t.entryLog, src, dst)
+	if err != nil {
+		return t.skipOnError(src, err)
+	}
+
+	return processOrdered(ctx, t.settings.Concurrency, entries,
+		t.readEntry, t.writeEntry)
+}
+
+func (t *TarArchiver) ArchiveContent(ctx context.Context, src []byte, dst string, mode os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	header, err := t.writeContent(src, dst, mode)
+	if err != nil {
+		return t.skipOnError(dst, err)
+	}
+
+	t.recordBytes(dst, os.FileMode(header.Mode), src)
+
+	return nil
+}
+
+func (t *TarArchiver) writeContent(src []byte, dst string, mode os.FileMode) (*tar.Header, error) {
+	header := &tar.Header{
 		Name:     dst,
 		Size:     int64(len(src)),
-		Mode:     666,
+		Mode:     int64(mode.Perm()),
 		ModTime:  time.Now(),
 		Typeflag: tar.TypeReg,
-	})
+	}
+
+	t.setHeader(header)
+
+	err := t.tarWriter.WriteHeader(header)
 	if err != nil {
-		return fmt.Errorf("error ArchiveContent: append file %s to zip: %w",
+		return nil, fmt.Errorf("error ArchiveContent: append file %s to zip: %w",
 			dst, err)
 	}
 
 	if _, err := t.tarWriter.Write(src); err != nil {
-		return fmt.Errorf("error ArchiveContent: write to zip: %w", err)
+		return nil, fmt.Errorf("error ArchiveContent: write to zip: %w", err)
+	}
+
+	return header, nil
+}
+
+// MergeArchive copies the regular files of the zip or tar archive src
+// selected by filter, failing entries are logged and skipped.
+func (t *TarArchiver) MergeArchive(ctx context.Context, src string, filter *SourceFilter) error {
+	return walkSourceArchive(ctx, src, filter, func(e *sourceEntry) error {
+		if err := t.writeSourceEntry(ctx, e, filter.target(e.name)); err != nil {
+			if isContextError(err) {
+				return err
+			}
+
+			log.Printf("error MergeArchive: copy %s from %s: %s", e.name, src, err)
+
+			t.skip(src+":"+e.name, err)
+		}
+
+		return nil
+	})
+}
+
+// writeSourceEntry copies the content of a source archive entry as dst.
+func (t *TarArchiver) writeSourceEntry(ctx context.Context, e *sourceEntry, dst string) error {
+	rc, err := e.open()
+	if err != nil {
+		return fmt.Errorf("error writeSourceEntry: open %s: %w", e.name, err)
+	}
+
+	defer rc.Close()
+
+	header := &tar.Header{
+		Name:     dst,
+		Size:     e.size,
+		Mode:     int64(e.mode),
+		ModTime:  e.modTime,
+		Typeflag: tar.TypeReg,
+	}
+
+	t.setHeader(header)
+
+	if err := t.tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writeSourceEntry: write header: %w", err)
+	}
+
+	sum := sha256.New()
+
+	n, err := copyWithContext(ctx, io.MultiWriter(t.tarWriter, sum), rc)
+	if err != nil {
+		if isContextError(err) {
+			return err
+		}
+
+		// the header is written, zeros complete the entry so the next ones can follow.
+		if _, padErr := io.CopyN(t.tarWriter, zeroReader{}, max(0, e.size-n)); padErr != nil {
+			err = errors.Join(err, padErr)
+		}
+
+		return fmt.Errorf("error writeSourceEntry: write to tar: %w", err)
+	}
+
+	t.record(dst, n, e.mode, sum)
+
+	return nil
+}
+
+// writeManifest writes the manifest of every recorded entry
+// as the last entry of the tarball.
+func (t *TarArchiver) writeManifest(ctx context.Context) error {
+	if t.settings.Manifest == nil || ctx.Err() != nil {
+		return nil
+	}
+
+	if err := t.checkManifestPath(t.settings.Manifest.Path); err != nil {
+		return err
+	}
+
+	b, err := buildManifest(t.settings.Manifest.Format, t.entries)
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.writeContent(b, t.settings.Manifest.Path, DefaultContentMode); err != nil {
+		return fmt.Errorf("error writeManifest: %w", err)
 	}
 
 	return nil
 }
 
-func (t *TarArchiver) Open(tarName string, opts ...Options) error {
+// Open creates a temporary archive next to tarName
+// the archive is only moved to tarName by a successful Close.
+func (t *TarArchiver) Open(ctx context.Context, tarName string, opts ...Options) error {
+	var err error
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
 	archiveSettings := &ArchiveSettings{
-		FileMode: DefaultArchiveMode,
+		FileMode:    DefaultArchiveMode,
+		Concurrency: runtime.NumCPU(),
 	}
 
 	for _, opt := range opts {
 		opt(archiveSettings)
 	}
 
-	f, err := os.OpenFile(tarName, os.O_APPEND|os.O_CREATE|os.O_RDWR, archiveSettings.FileMode)
+	if archiveSettings.ExcludeList != nil {
+		archiveSettings.ExcludeList, err = resolveExcludeList(archiveSettings.ExcludeList)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := createTmpArchive(tarName, archiveSettings.FileMode)
 	if err != nil {
-		return fmt.Errorf("error: Create zip file %s: %w", tarName, err)
+		return fmt.Errorf("error: Create tar file %s: %w", tarName, err)
 	}
 
 	t.tarFile = f
 	t.fileName = tarName
-	t.gzipWriter = gzip.NewWriter(f)
-	t.tarWriter = tar.NewWriter(t.gzipWriter)
+	t.reset()
 	t.settings = archiveSettings
+	t.owner = archiveSettings.Owner
+	t.links = newLinkIndex(archiveSettings.Links)
+	t.ageWriter = nil
+	t.plainMD5 = nil
+	t.plainSHA256 = nil
 
-	if t.settings.ExcludeList != nil {
-		t.settings.ExcludeList, err = resolveExcludeList(t.settings.ExcludeList)
+	var w io.Writer = f
+
+	if t.settings.Age != nil {
+		t.ageWriter, err = newAgeWriter(f, t.settings.Age)
 		if err != nil {
-			return err
+			return errors.Join(err, f.Close(), removeTmpArchive(f.Name()))
 		}
+
+		t.plainMD5 = md5.New()
+		t.plainSHA256 = sha256.New()
+		w = io.MultiWriter(t.ageWriter, t.plainMD5, t.plainSHA256)
 	}
 
+	// the gzip stream is always written in blocks, so the archive bytes
+	// do not depend on the number of workers compressing them.
+	t.gzipWriter = newParallelGzipWriter(w, max(1, t.settings.Concurrency))
+
+	t.tarWriter = tar.NewWriter(t.gzipWriter)
+
 	return nil
 }
 
-func (t *TarArchiver) Close() error {
-	err := errors.Join(t.tarWriter.Close(),
+// Close flushes the archive and moves it to its final location
+// if ctx is done or flushing fails, the temporary archive is removed instead.
+func (t *TarArchiver) Close(ctx context.Context) error {
+	err := errors.Join(t.writeManifest(ctx),
+		t.tarWriter.Close(),
 		t.gzipWriter.Close(),
+		t.closeAge(),
 		t.tarFile.Close())
 	if err != nil {
+		return fmt.Errorf("error Close: %w",
+			errors.Join(err, removeTmpArchive(t.tarFile.Name())))
+	}
+
+	if err := commitTmpArchive(ctx, t.tarFile.Name(), t.fileName); err != nil {
 		return fmt.Errorf("error Close: %w", err)
 	}
 
 	return nil
 }
+
+// closeAge flushes the last encrypted chunk.
+func (t *TarArchiver) closeAge() error {
+	if t.ageWriter == nil {
+		return nil
+	}
+
+	return t.ageWriter.Close()
+}
+
+// setHeader sets the owner and the format of header, access and change
+// times are cleared so archiving the same files gives the same archive,
+// ModTime keeps its sub-second part only with PAX, the other formats
+// round it to the second.
+func (t *TarArchiver) setHeader(header *tar.Header) {
+	t.owner.apply(header)
+
+	header.Format = t.settings.TarFormat
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+
+	if header.Format != tar.FormatPAX {
+		header.ModTime = header.ModTime.Truncate(time.Second)
+	}
+}
+
+// SetEntryOwner overrides the owner of the next entries on top of
+// the owner of the archive, nil restores the owner of the archive.
+func (t *TarArchiver) SetEntryOwner(owner *OwnerSettings) {
+	t.owner = t.settings.Owner.merge(owner)
+}
+
+// PlaintextChecksums returns the md5 and sha256 of the compressed tarball
+// before it was encrypted, ok is false if the tarball is not encrypted.
+func (t *TarArchiver) PlaintextChecksums() (string, string, bool) {
+	if t.plainSHA256 == nil {
+		return "", "", false
+	}
+
+	return fmt.Sprintf("%x", t.plainMD5.Sum(nil)),
+		fmt.Sprintf("%x", t.plainSHA256.Sum(nil)), true
+}
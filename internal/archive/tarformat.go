@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// tar header formats selectable with WithTarFormat.
+var tarFormats = map[string]tar.Format{
+	"ustar": tar.FormatUSTAR,
+	"pax":   tar.FormatPAX,
+	"gnu":   tar.FormatGNU,
+}
+
+// TarFormatNames returns the names accepted by ParseTarFormat.
+func TarFormatNames() []string {
+	names := make([]string, 0, len(tarFormats))
+
+	for name := range tarFormats {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// ParseTarFormat returns the tar header format name, ustar, pax or gnu.
+func ParseTarFormat(name string) (tar.Format, error) {
+	format, ok := tarFormats[strings.ToLower(name)]
+	if !ok {
+		return tar.FormatUnknown, fmt.Errorf("error ParseTarFormat: unsupported tar format %q, "+
+			"only %s are supported", name, strings.Join(TarFormatNames(), ", "))
+	}
+
+	return format, nil
+}
+
+// TarFormatMismatches returns why the entries whose path, size or owner
+// can not be encoded with format, in entries order.
+func TarFormatMismatches(format tar.Format, owner *OwnerSettings, entries []Entry) []string {
+	mismatches := make([]string, 0)
+
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.Path,
+			Size:     e.Size,
+			Mode:     int64(e.Mode.Perm()),
+			Typeflag: tar.TypeReg,
+			Format:   format,
+		}
+
+		owner.apply(header)
+
+		// the header is only encoded, its content is never written.
+		if err := tar.NewWriter(io.Discard).WriteHeader(header); err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %s", e.Path, err))
+		}
+	}
+
+	return mismatches
+}
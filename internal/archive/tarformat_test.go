@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarFormat(t *testing.T) {
+	for name, expected := range map[string]tar.Format{
+		"ustar": tar.FormatUSTAR,
+		"PAX":   tar.FormatPAX,
+		"gnu":   tar.FormatGNU,
+	} {
+		format, err := ParseTarFormat(name)
+
+		require.Nil(t, err)
+
+		assert.Equal(t, expected, format, name)
+	}
+
+	_, err := ParseTarFormat("v7")
+
+	assert.NotNil(t, err)
+}
+
+func TestTarFormatMismatches(t *testing.T) {
+	entries := []Entry{
+		{Path: "short.txt", Size: 10, Mode: 0o644},
+		{Path: strings.Repeat("a", 120), Size: 10, Mode: 0o644},
+		{Path: "naïve.txt", Size: 10, Mode: 0o644},
+		{Path: "image.raw", Size: 10 << 30, Mode: 0o644},
+	}
+
+	mismatches := TarFormatMismatches(tar.FormatUSTAR, nil, entries)
+
+	require.Len(t, mismatches, 3)
+
+	assert.True(t, strings.HasPrefix(mismatches[0], strings.Repeat("a", 120)))
+	assert.True(t, strings.HasPrefix(mismatches[1], "naïve.txt"))
+	assert.True(t, strings.HasPrefix(mismatches[2], "image.raw"))
+
+	assert.Empty(t, TarFormatMismatches(tar.FormatPAX, nil, entries))
+
+	owner := &OwnerSettings{UID: 1 << 24, GID: KeepID}
+
+	assert.Len(t, TarFormatMismatches(tar.FormatUSTAR, owner, entries[:1]), 1)
+	assert.Empty(t, TarFormatMismatches(tar.FormatGNU, owner, entries[:1]))
+}
+
+func TestTarArchiver_TarFormat(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "file.txt")
+
+	require.Nil(t, os.WriteFile(src, []byte("file"), 0o644))
+
+	for _, format := range []tar.Format{tar.FormatUSTAR, tar.FormatPAX, tar.FormatGNU} {
+		t.Run(format.String(), func(t *testing.T) {
+			name := filepath.Join(dir, format.String()+".tar.gz")
+
+			a := GetArchiver("tar.gz")
+
+			require.Nil(t, a.Open(context.Background(), name, WithTarFormat(format)))
+
+			err := errors.Join(a.ArchiveFile(context.Background(), src, "file.txt"),
+				a.ArchiveContent(context.Background(), []byte("content"), "content.txt", DefaultContentMode),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			f, err := os.Open(name)
+
+			require.Nil(t, err)
+
+			defer f.Close()
+
+			gr, err := gzip.NewReader(f)
+
+			require.Nil(t, err)
+
+			r := tar.NewReader(gr)
+
+			count := 0
+
+			for {
+				h, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				require.Nil(t, err)
+
+				// PAX entries needing no extended record are USTAR headers.
+				if format == tar.FormatPAX {
+					assert.NotZero(t, h.Format&(tar.FormatPAX|tar.FormatUSTAR), h.Name)
+				} else {
+					assert.NotZero(t, h.Format&format, h.Name)
+				}
+
+				assert.True(t, h.AccessTime.IsZero(), h.Name)
+				assert.True(t, h.ChangeTime.IsZero(), h.Name)
+
+				count++
+			}
+
+			assert.Equal(t, 2, count)
+		})
+	}
+}
+
+func TestTarArchiver_TarFormatReproducible(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+
+	require.Nil(t, os.MkdirAll(src, 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("b"), 0o644))
+
+	archives := make([][]byte, 0, 2)
+
+	for i := range 2 {
+		// reading the files changes their access time, and Chtimes their change time.
+		now := time.Now().Add(time.Duration(i) * time.Hour)
+		modTime := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+
+		for _, name := range []string{"a.txt", "b.txt"} {
+			require.Nil(t, os.Chtimes(filepath.Join(src, name), now, modTime))
+		}
+
+		name := filepath.Join(dir, fmt.Sprintf("%d.tar.gz", i))
+
+		a := GetArchiver("tar.gz")
+
+		require.Nil(t, a.Open(context.Background(), name, WithTarFormat(tar.FormatPAX)))
+
+		err := errors.Join(a.ArchiveDir(context.Background(), src, "src"),
+			a.Close(context.Background()))
+
+		require.Nil(t, err)
+
+		b, err := os.ReadFile(name)
+
+		require.Nil(t, err)
+
+		archives = append(archives, b)
+	}
+
+	assert.Equal(t, archives[0], archives[1])
+
+	gr, err := gzip.NewReader(bytes.NewReader(archives[0]))
+
+	require.Nil(t, err)
+
+	r := tar.NewReader(gr)
+
+	for {
+		h, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.Nil(t, err)
+
+		if h.Typeflag == tar.TypeReg {
+			assert.Equal(t, 600, h.ModTime.Nanosecond(), h.Name)
+		}
+	}
+}
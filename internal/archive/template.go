@@ -0,0 +1,27 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"text/template"
+)
+
+// RenderTemplate renders the go text/template file name with vars
+// referencing an undefined variable is an error.
+func RenderTemplate(name string, vars map[string]string) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(name)).
+		Option("missingkey=error").
+		ParseFiles(name)
+	if err != nil {
+		return nil, fmt.Errorf("error RenderTemplate: parse %s: %w", name, err)
+	}
+
+	out := new(bytes.Buffer)
+
+	if err := tmpl.Execute(out, vars); err != nil {
+		return nil, fmt.Errorf("error RenderTemplate: render %s: %w", name, err)
+	}
+
+	return out.Bytes(), nil
+}
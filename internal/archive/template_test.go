@@ -0,0 +1,30 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.yaml.tmpl")
+
+	require.Nil(t, os.WriteFile(name, []byte("env: {{ .env }}\nport: {{ .port }}\n"), 0o644))
+
+	b, err := RenderTemplate(name, map[string]string{"env": "prod", "port": "8080"})
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "env: prod\nport: 8080\n", string(b))
+
+	_, err = RenderTemplate(name, map[string]string{"env": "prod"})
+
+	assert.NotNil(t, err)
+
+	_, err = RenderTemplate(filepath.Join(t.TempDir(), "missing.tmpl"), nil)
+
+	assert.NotNil(t, err)
+}
@@ -3,9 +3,13 @@ package archive
 import (
 	"archive/tar"
 	"archive/zip"
-	"compress/gzip"
+	"context"
+	"hash"
+	"io"
 	"os"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 )
 
@@ -16,19 +20,49 @@ type ArchiveSettings struct {
 	FileMode os.FileMode
 	// include symbolic links
 	SymLink bool
+	// number of files read and compressed in parallel by ArchiveDir
+	Concurrency int
+	// manifest written as the last entry, nil to skip it
+	Manifest *ManifestSettings
+	// zip entries encryption, nil to skip it
+	Encryption *EncryptionSettings
+	// whole tarball age encryption, nil to skip it
+	Age *AgeSettings
+	// directory entries written by ArchiveDir, nil to skip them
+	Dirs *DirSettings
+	// owner of the tar entries, nil to keep the owner of the files
+	Owner *OwnerSettings
+	// header format of the tar entries, picked per entry if unknown
+	TarFormat tar.Format
+	// extended attributes stored in tar entries, nil to skip them
+	Xattrs *XattrSettings
+	// hard links written by ArchiveDir, nil to write every file in full
+	Links *LinkSettings
+	// write the holes of sparse files as PAX sparse entries, nil to write them in full
+	Sparse *SparseSettings
+	// write the headers of devices and named pipes, skip them otherwise
+	SpecialFiles bool
 }
 
 type Options func(*ArchiveSettings)
 
+// Archiver writes files, directories and raw bytes into an archive.
+// Every method takes a context, long-running operations check it between
+// entries and while copying data, so a cancelled or timed out context stops
+// the archiving and Close discards the partially written archive.
 type Archiver interface {
-	ArchiveFile(src, dst string) error
-	ArchiveDir(src, dst string) error
-	ArchiveContent(src []byte, dst string) error
-	Open(zipName string, opts ...Options) error
-	Close() error
+	ArchiveFile(ctx context.Context, src, dst string) error
+	ArchiveDir(ctx context.Context, src, dst string) error
+	ArchiveContent(ctx context.Context, src []byte, dst string, mode os.FileMode) error
+	MergeArchive(ctx context.Context, src string, filter *SourceFilter) error
+	Entries() []Entry
+	Stats() Stats
+	Open(ctx context.Context, zipName string, opts ...Options) error
+	Close(ctx context.Context) error
 }
 
 type ZipArchiver struct {
+	entryLog
 	zipFile   *os.File
 	zipWriter *zip.Writer
 	settings  *ArchiveSettings
@@ -36,42 +70,199 @@ type ZipArchiver struct {
 }
 
 type TarArchiver struct {
+	entryLog
 	tarFile    *os.File
-	gzipWriter *gzip.Writer
+	ageWriter  io.WriteCloser
+	gzipWriter io.WriteCloser
 	tarWriter  *tar.Writer
 	settings   *ArchiveSettings
 	fileName   string
+	// owner of the next entries, see SetEntryOwner
+	owner *OwnerSettings
+	// entries written so far, hard link targets of the next ones
+	links *linkIndex
+	// checksums of the compressed stream before age encryption
+	plainMD5    hash.Hash
+	plainSHA256 hash.Hash
 }
 
-var archivers = map[string]Archiver{
-	"zip":    &ZipArchiver{},
-	"tar.gz": &TarArchiver{},
+// PlaintextChecksummer is implemented by archivers encrypting the whole archive
+// it returns the md5 and sha256 of the archive before encryption.
+type PlaintextChecksummer interface {
+	PlaintextChecksums() (string, string, bool)
+}
+
+// archivers creates a new archiver per archive type
+// so archives of the same type can be written concurrently.
+var archivers = map[string]func() Archiver{
+	"zip":    func() Archiver { return &ZipArchiver{} },
+	"tar.gz": func() Archiver { return &TarArchiver{} },
+}
+
+// EntryOwner overrides the owner of the tar entries of a block.
+type EntryOwner struct {
+	Owner types.String `tfsdk:"owner"`
+	Group types.String `tfsdk:"group"`
+	UID   types.Int64  `tfsdk:"uid"`
+	GID   types.Int64  `tfsdk:"gid"`
 }
 
 type File struct {
 	Path types.String `tfsdk:"path"`
+	EntryOwner
 }
 
 type Dir struct {
 	Path types.String `tfsdk:"path"`
+	EntryOwner
 }
 
 type Content struct {
 	Src      types.String `tfsdk:"src"`
+	Text     types.String `tfsdk:"text"`
+	Base64   types.String `tfsdk:"base64"`
 	FilePath types.String `tfsdk:"file_path"`
+	EntryOwner
+}
+
+type Template struct {
+	Source   types.String `tfsdk:"source"`
+	Vars     types.Map    `tfsdk:"vars"`
+	FilePath types.String `tfsdk:"file_path"`
+	Mode     types.String `tfsdk:"mode"`
+}
+
+type SourceArchive struct {
+	Path    types.String `tfsdk:"path"`
+	Include types.List   `tfsdk:"include"`
+	Exclude types.List   `tfsdk:"exclude"`
+	Prefix  types.String `tfsdk:"prefix"`
+}
+
+type Nested struct {
+	FilePath      types.String `tfsdk:"file_path"`
+	Type          types.String `tfsdk:"type"`
+	FileBlocks    types.Set    `tfsdk:"file"`
+	DirBlocks     types.Set    `tfsdk:"dir"`
+	ContentBlocks types.Set    `tfsdk:"content"`
+}
+
+type SplitPart struct {
+	Path   types.String `tfsdk:"path"`
+	Size   types.Int64  `tfsdk:"size"`
+	MD5    types.String `tfsdk:"md5"`
+	SHA256 types.String `tfsdk:"sha256"`
+}
+
+var splitPartAttrTypes = map[string]attr.Type{
+	"path":   types.StringType,
+	"size":   types.Int64Type,
+	"md5":    types.StringType,
+	"sha256": types.StringType,
+}
+
+type ArchivedEntry struct {
+	Path   types.String `tfsdk:"path"`
+	Size   types.Int64  `tfsdk:"size"`
+	Mode   types.String `tfsdk:"mode"`
+	SHA256 types.String `tfsdk:"sha256"`
+}
+
+var archivedEntryAttrTypes = map[string]attr.Type{
+	"path":   types.StringType,
+	"size":   types.Int64Type,
+	"mode":   types.StringType,
+	"sha256": types.StringType,
+}
+
+type SkippedPath struct {
+	Path   types.String `tfsdk:"path"`
+	Reason types.String `tfsdk:"reason"`
+}
+
+var skippedPathAttrTypes = map[string]attr.Type{
+	"path":   types.StringType,
+	"reason": types.StringType,
+}
+
+type Signing struct {
+	Format         types.String `tfsdk:"format"`
+	PrivateKey     types.String `tfsdk:"private_key"`
+	PrivateKeyFile types.String `tfsdk:"private_key_file"`
+}
+
+type ChecksumFile struct {
+	SHA256   types.Bool   `tfsdk:"sha256"`
+	MD5      types.Bool   `tfsdk:"md5"`
+	Manifest types.String `tfsdk:"manifest"`
+}
+
+type Manifest struct {
+	Path   types.String `tfsdk:"path"`
+	Format types.String `tfsdk:"format"`
+}
+
+type Encryption struct {
+	Method   types.String `tfsdk:"method"`
+	Password types.String `tfsdk:"password"`
 }
 
 type Model struct {
-	Name           types.String `tfsdk:"name"`
-	Type           types.String `tfsdk:"type"`
-	OutMode        types.String `tfsdk:"out_mode"`
-	MD5            types.String `tfsdk:"md5"`
-	SHA256         types.String `tfsdk:"sha256"`
-	AbsPath        types.String `tfsdk:"abs_path"`
-	ExcludeList    types.List   `tfsdk:"exclude_list"`
-	ResolveSymLink types.Bool   `tfsdk:"resolve_symlink"`
-	FileBlocks     types.Set    `tfsdk:"file"`
-	DirBlocks      types.Set    `tfsdk:"dir"`
-	ContentBlocks  types.Set    `tfsdk:"content"`
-	Size           types.Int64  `tfsdk:"size"`
+	Name           types.String   `tfsdk:"name"`
+	Type           types.String   `tfsdk:"type"`
+	OutMode        types.String   `tfsdk:"out_mode"`
+	MD5            types.String   `tfsdk:"md5"`
+	SHA256         types.String   `tfsdk:"sha256"`
+	AbsPath        types.String   `tfsdk:"abs_path"`
+	ExcludeList    types.List     `tfsdk:"exclude_list"`
+	ResolveSymLink types.Bool     `tfsdk:"resolve_symlink"`
+	Concurrency    types.Int64    `tfsdk:"concurrency"`
+	FileBlocks     types.Set      `tfsdk:"file"`
+	DirBlocks      types.Set      `tfsdk:"dir"`
+	ContentBlocks  types.Set      `tfsdk:"content"`
+	TemplateBlocks types.Set      `tfsdk:"template"`
+	SourceArchives types.Set      `tfsdk:"source_archive"`
+	NestedBlocks   types.Set      `tfsdk:"nested"`
+	Size           types.Int64    `tfsdk:"size"`
+	Signing        *Signing       `tfsdk:"signing"`
+	Signature      types.String   `tfsdk:"signature"`
+	PublicKeyID    types.String   `tfsdk:"public_key_id"`
+	SignaturePath  types.String   `tfsdk:"signature_path"`
+	ChecksumFile   *ChecksumFile  `tfsdk:"checksum_file"`
+	ChecksumFiles  types.List     `tfsdk:"checksum_file_paths"`
+	SumsManifest   types.String   `tfsdk:"checksum_manifest_path"`
+	Manifest       *Manifest      `tfsdk:"manifest"`
+	Encryption     *Encryption    `tfsdk:"encryption"`
+	EncryptTo      types.List     `tfsdk:"encrypt_to"`
+	Passphrase     types.String   `tfsdk:"encrypt_passphrase"`
+	PlainMD5       types.String   `tfsdk:"plaintext_md5"`
+	PlainSHA256    types.String   `tfsdk:"plaintext_sha256"`
+	SplitSize      types.String   `tfsdk:"split_size"`
+	MaxSize        types.String   `tfsdk:"max_size"`
+	MaxEntrySize   types.String   `tfsdk:"max_entry_size"`
+	IncludeBase64  types.Bool     `tfsdk:"include_base64"`
+	EmptyDirs      types.Bool     `tfsdk:"include_empty_dirs"`
+	DirEntries     types.Bool     `tfsdk:"directory_entries"`
+	DirMode        types.String   `tfsdk:"dir_mode"`
+	NumericOwner   types.Bool     `tfsdk:"numeric_owner"`
+	TarFormat      types.String   `tfsdk:"tar_format"`
+	PreserveXattrs types.Bool     `tfsdk:"preserve_xattrs"`
+	PreserveACLs   types.Bool     `tfsdk:"preserve_acls"`
+	SpecialFiles   types.String   `tfsdk:"special_files"`
+	SparseFiles    types.Bool     `tfsdk:"sparse_files"`
+	SparseHashes   types.Bool     `tfsdk:"sparse_hashes"`
+	HardLinks      types.Bool     `tfsdk:"hard_links"`
+	DedupeFiles    types.Bool     `tfsdk:"dedupe_files"`
+	Base64MaxSize  types.String   `tfsdk:"base64_max_size"`
+	Base64         types.String   `tfsdk:"output_base64"`
+	EntryCount     types.Int64    `tfsdk:"entry_count"`
+	Uncompressed   types.Int64    `tfsdk:"uncompressed_size"`
+	Ratio          types.Float64  `tfsdk:"compression_ratio"`
+	ExcludedCount  types.Int64    `tfsdk:"excluded_count"`
+	Skipped        types.List     `tfsdk:"skipped"`
+	Entries        types.List     `tfsdk:"entries"`
+	Parts          types.List     `tfsdk:"parts"`
+	Timeouts       timeouts.Value `tfsdk:"timeouts"`
+	// owner of the tar entries, overridden per block
+	EntryOwner
 }
@@ -0,0 +1,127 @@
+package archive
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prefix of the PAX records storing the extended attributes of an entry.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// extended attributes Linux stores the POSIX ACLs of a file in
+// and the PAX records GNU tar and bsdtar restore them from.
+var aclXattrs = map[string]string{
+	"system.posix_acl_access":  "SCHILY.acl.access",
+	"system.posix_acl_default": "SCHILY.acl.default",
+}
+
+// tags of the entries of a binary POSIX ACL, see acl_ea.h.
+var aclTags = map[uint16]string{
+	0x01: "user",
+	0x02: "user",
+	0x04: "group",
+	0x08: "group",
+	0x10: "mask",
+	0x20: "other",
+}
+
+// tags of the entries of a binary POSIX ACL naming a user or group id.
+const aclTagsWithID = 0x02 | 0x08
+
+// version of the binary POSIX ACLs.
+const aclVersion = 2
+
+// XattrSettings selects the extended attributes stored in tar entries.
+type XattrSettings struct {
+	// every extended attribute but the ACLs, e.g. security.capability
+	Xattrs bool
+	// POSIX ACLs
+	ACLs bool
+}
+
+// paxRecords returns the selected extended attributes of the file src
+// as PAX records, nil if none is selected or set, ACLs are stored
+// in their text form, the only one tar extractors restore.
+func (s *XattrSettings) paxRecords(src string) (map[string]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	names, err := listXattrs(src)
+	if err != nil {
+		return nil, fmt.Errorf("error paxRecords: list xattrs of %s: %w", src, err)
+	}
+
+	var records map[string]string
+
+	for _, name := range names {
+		aclRecord, acl := aclXattrs[name]
+		if acl && !s.ACLs || !acl && !s.Xattrs {
+			continue
+		}
+
+		value, err := getXattr(src, name)
+		if err != nil {
+			return nil, fmt.Errorf("error paxRecords: get xattr %s of %s: %w", name, src, err)
+		}
+
+		if records == nil {
+			records = make(map[string]string)
+		}
+
+		if !acl {
+			records[paxXattrPrefix+name] = string(value)
+
+			continue
+		}
+
+		text, err := aclText(value)
+		if err != nil {
+			return nil, fmt.Errorf("error paxRecords: convert %s of %s: %w", name, src, err)
+		}
+
+		records[aclRecord] = text
+	}
+
+	return records, nil
+}
+
+// aclText converts a binary POSIX ACL, as Linux stores it in extended
+// attributes, to its text form with numeric ids, e.g.
+// user::rw-,user:1000:r--,group::r--,mask::r--,other::r--.
+func aclText(b []byte) (string, error) {
+	if len(b) < 4 || (len(b)-4)%8 != 0 || binary.LittleEndian.Uint32(b) != aclVersion {
+		return "", fmt.Errorf("error aclText: invalid ACL of %d bytes", len(b))
+	}
+
+	entries := make([]string, 0, (len(b)-4)/8)
+
+	for e := b[4:]; len(e) > 0; e = e[8:] {
+		tag := binary.LittleEndian.Uint16(e)
+		perm := binary.LittleEndian.Uint16(e[2:])
+
+		name, ok := aclTags[tag]
+		if !ok {
+			return "", fmt.Errorf("error aclText: unknown ACL tag %#x", tag)
+		}
+
+		id := ""
+		if tag&aclTagsWithID != 0 {
+			id = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(e[4:])), 10)
+		}
+
+		perms := []byte("---")
+
+		for i, c := range "rwx" {
+			if perm&(4>>i) != 0 {
+				perms[i] = byte(c)
+			}
+		}
+
+		entries = append(entries, name+":"+id+":"+string(perms))
+	}
+
+	return strings.Join(entries, ","), nil
+}
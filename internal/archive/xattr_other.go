@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package archive
+
+// listXattrs returns no extended attributes where they are not supported.
+func listXattrs(_ string) ([]string, error) {
+	return nil, nil
+}
+
+func getXattr(_, _ string) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTarArchiver_Xattrs(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+
+	require.Nil(t, os.MkdirAll(src, 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "bin"), []byte("bin"), 0o755))
+
+	if err := unix.Setxattr(filepath.Join(src, "bin"), "user.test", []byte("value"), 0); err != nil {
+		t.Skipf("extended attributes not supported: %s", err)
+	}
+
+	// user::rw-,user:1000:r--,group::r--,mask::r--,other::r--
+	acl := []byte{
+		2, 0, 0, 0,
+		0x01, 0, 6, 0, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0, 4, 0, 0xe8, 0x03, 0, 0,
+		0x04, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+		0x10, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0, 4, 0, 0xff, 0xff, 0xff, 0xff,
+	}
+
+	if err := unix.Setxattr(filepath.Join(src, "bin"), "system.posix_acl_access", acl, 0); err != nil {
+		t.Skipf("POSIX ACLs not supported: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		xattrs   bool
+		acls     bool
+		expected map[string]string
+	}{
+		{
+			name:     "xattrs",
+			xattrs:   true,
+			expected: map[string]string{paxXattrPrefix + "user.test": "value"},
+		},
+		{
+			name: "acls",
+			acls: true,
+			expected: map[string]string{
+				"SCHILY.acl.access": "user::rw-,user:1000:r--,group::r--,mask::r--,other::r--",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name+".tar.gz")
+
+			a := GetArchiver("tar.gz")
+
+			require.Nil(t, a.Open(context.Background(), name, WithXattrs(tt.xattrs, tt.acls)))
+
+			err := errors.Join(a.ArchiveDir(context.Background(), src, "src"),
+				a.ArchiveFile(context.Background(), filepath.Join(src, "bin"), "bin"),
+				a.Close(context.Background()))
+
+			require.Nil(t, err)
+
+			f, err := os.Open(name)
+
+			require.Nil(t, err)
+
+			defer f.Close()
+
+			gr, err := gzip.NewReader(f)
+
+			require.Nil(t, err)
+
+			r := tar.NewReader(gr)
+
+			count := 0
+
+			for {
+				h, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				require.Nil(t, err)
+
+				assert.Equal(t, tt.expected, h.PAXRecords, h.Name)
+
+				count++
+			}
+
+			assert.Equal(t, 2, count)
+		})
+	}
+}
+
+func TestACLText(t *testing.T) {
+	text, err := aclText([]byte{2, 0, 0, 0, 0x08, 0, 5, 0, 0x0a, 0, 0, 0})
+
+	require.Nil(t, err)
+
+	assert.Equal(t, "group:10:r-x", text)
+
+	_, err = aclText([]byte{2, 0, 0, 0, 0x40, 0, 5, 0, 0, 0, 0, 0})
+
+	assert.NotNil(t, err)
+
+	_, err = aclText([]byte{1, 0, 0, 0})
+
+	assert.NotNil(t, err)
+}
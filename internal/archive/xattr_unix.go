@@ -0,0 +1,64 @@
+//go:build linux || darwin
+
+package archive
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// listXattrs returns the names of the extended attributes of path
+// none if its file system does not support them.
+func listXattrs(path string) ([]string, error) {
+	b, err := readXattr(func(dest []byte) (int, error) {
+		return unix.Listxattr(path, dest)
+	})
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil, nil
+	}
+
+	if err != nil || len(b) == 0 {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+
+	for _, name := range bytes.Split(bytes.TrimSuffix(b, []byte{0}), []byte{0}) {
+		names = append(names, string(name))
+	}
+
+	return names, nil
+}
+
+// getXattr returns the value of the extended attribute name of path.
+func getXattr(path, name string) ([]byte, error) {
+	return readXattr(func(dest []byte) (int, error) {
+		return unix.Getxattr(path, name, dest)
+	})
+}
+
+// readXattr calls read with a buffer of the size it reports
+// until the value does not grow between both calls.
+func readXattr(read func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+
+		dest := make([]byte, size)
+
+		size, err = read(dest)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return dest[:size], nil
+	}
+}
@@ -2,19 +2,24 @@ package archive
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"log"
+	"math"
 	"os"
-	"path/filepath"
-	"slices"
-	"strings"
+	"runtime"
 )
 
 // writeToZip create a new file dst inside the zip file
 // copies src content to the newly created dst file.
-func (z *ZipArchiver) writeToZip(src, dst string) error {
+func (z *ZipArchiver) writeToZip(ctx context.Context, src, dst string) error {
 	f, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("error writeToZip: open %s: %w", src, err)
@@ -22,137 +27,571 @@ func (z *ZipArchiver) writeToZip(src, dst string) error {
 
 	defer f.Close()
 
-	w, err := z.zipWriter.Create(dst)
+	header := &zip.FileHeader{
+		Name:   dst,
+		Method: zip.Deflate,
+	}
+
+	if z.settings.Encryption != nil {
+		n, sum, err := z.writeEncrypted(ctx, f, header)
+		if err != nil {
+			return fmt.Errorf("error writeToZip: %w", err)
+		}
+
+		z.record(dst, n, header.Mode(), sum)
+
+		return nil
+	}
+
+	w, err := z.zipWriter.CreateHeader(header)
 	if err != nil {
 		return fmt.Errorf("error writeToZip: create %s writer: %w", dst, err)
 	}
 
-	if _, err := io.Copy(w, f); err != nil {
+	sum := sha256.New()
+
+	n, err := copyWithContext(ctx, io.MultiWriter(w, sum), f)
+	if err != nil {
 		return fmt.Errorf("error writeToZip: write to zip: %w", err)
 	}
 
+	z.record(dst, n, header.Mode(), sum)
+
 	return nil
 }
 
+// writeEncrypted compresses and encrypts r as the entry described by header
+// while writing it, the crc and sizes are only known once r is read
+// so they follow the data in a data descriptor.
+func (z *ZipArchiver) writeEncrypted(ctx context.Context, r io.Reader,
+	header *zip.FileHeader,
+) (int64, hash.Hash, error) {
+	header.Method = zip.Deflate
+	header.Flags |= zipFlagDataDescriptor
+	header.CreatorVersion = zipVersion20
+	header.ReaderVersion = zipVersion20
+
+	if !isASCII(header.Name) {
+		header.Flags |= zipFlagUTF8
+	}
+
+	if err := encryptZipHeader(z.settings.Encryption, header); err != nil {
+		return 0, nil, err
+	}
+
+	w, err := z.zipWriter.CreateRaw(header)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error writeEncrypted: create %s writer: %w", header.Name, err)
+	}
+
+	ew, err := newZipEncryptWriter(z.settings.Encryption, header, w)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fw, err := flate.NewWriter(ew, flate.DefaultCompression)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error writeEncrypted: create compressor: %w", err)
+	}
+
+	crc := crc32.NewIEEE()
+	sum := sha256.New()
+
+	n, err := copyWithContext(ctx, io.MultiWriter(fw, crc, sum), r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error writeEncrypted: write to zip: %w", err)
+	}
+
+	if err := errors.Join(fw.Close(), ew.Close()); err != nil {
+		return 0, nil, fmt.Errorf("error writeEncrypted: flush: %w", err)
+	}
+
+	// the zip writer writes the data descriptor from header once the entry is done,
+	// AE-2 entries store no crc.
+	if header.Method != zipMethodAES {
+		header.CRC32 = crc.Sum32()
+	}
+
+	header.CompressedSize64 = uint64(ew.n)
+	header.UncompressedSize64 = uint64(n)
+	header.CompressedSize = uint32(min(header.CompressedSize64, math.MaxUint32))
+	header.UncompressedSize = uint32(min(header.UncompressedSize64, math.MaxUint32))
+
+	return n, sum, nil
+}
+
 // ArchiveFile accepts an absolute path src  and any other path dst
 // every symbolic link is evaluated if SymLink is set to true
 // call writeToZip, to write src content to dst.
-func (z *ZipArchiver) ArchiveFile(src, dst string) error {
-	var err error
+func (z *ZipArchiver) ArchiveFile(ctx context.Context, src, dst string) error {
+	return z.skipOnError(src, z.archiveFile(ctx, src, dst))
+}
 
-	if slices.Contains(z.settings.ExcludeList, src) {
-		return nil
+func (z *ZipArchiver) archiveFile(ctx context.Context, src, dst string) error {
+	src, excluded, err := resolveSrc(z.settings, src)
+	if err != nil || excluded {
+		if excluded {
+			z.exclude()
+		}
+
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := checkZipSource(src); err != nil {
+		return err
+	}
+
+	return z.writeToZip(ctx, src, dst)
+}
+
+// compressedZipEntry is a file compressed ahead of being written to the zip
+// files bigger than maxBufferedEntrySize are streamed by writeToZip instead.
+type compressedZipEntry struct {
+	src    string
+	header *zip.FileHeader
+	data   []byte
+	sum    hash.Hash
+	size   uint64
+	stream bool
+	dir    bool
+}
+
+// compressEntry reads and deflates e into memory
+// so it can be written to the zip with CreateRaw.
+func (z *ZipArchiver) compressEntry(ctx context.Context, e dirEntry) (*compressedZipEntry, error) {
+	if e.dir {
+		return &compressedZipEntry{src: e.src, dir: true}, nil
+	}
+
+	src, excluded, err := resolveSrc(z.settings, e.src)
+	if err != nil || excluded {
+		return nil, err
+	}
+
+	if err := checkZipSource(src); err != nil {
+		return nil, err
 	}
 
-	if z.settings.SymLink {
-		src, err = evaluateSymLink(src)
+	return z.compressFile(ctx, src, e.dst)
+}
+
+// checkZipSource returns an error if src is a special file,
+// zip archives can not store them.
+func checkZipSource(src string) error {
+	info, err := specialFile(src)
+	if err != nil || info == nil {
+		return err
+	}
+
+	return specialFileError(src, info)
+}
+
+// compressFile deflates src into memory, big files are left to writeToZip.
+func (z *ZipArchiver) compressFile(ctx context.Context, src, dst string) (*compressedZipEntry, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("error compressFile: open %s: %w", src, err)
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error compressFile: get info %s: %w", src, err)
+	}
+
+	if info.Size() > maxBufferedEntrySize {
+		return &compressedZipEntry{src: src, stream: true}, nil
+	}
+
+	c, err := z.compress(ctx, f, dst)
+	if err != nil {
+		return nil, fmt.Errorf("error compressFile: compress %s: %w", src, err)
+	}
+
+	c.src = src
+
+	return c, nil
+}
+
+// compress deflates r into memory and builds the header to write it with CreateRaw
+// the compressed data is encrypted if Encryption is set.
+func (z *ZipArchiver) compress(ctx context.Context, r io.Reader, dst string) (*compressedZipEntry, error) {
+	data := new(bytes.Buffer)
+
+	fw, err := flate.NewWriter(data, flate.DefaultCompression)
+	if err != nil {
+		return nil, fmt.Errorf("error compress: create compressor: %w", err)
+	}
+
+	crc := crc32.NewIEEE()
+	sum := sha256.New()
+
+	n, err := copyWithContext(ctx, io.MultiWriter(fw, crc, sum), r)
+	if err != nil {
+		return nil, fmt.Errorf("error compress: %w", err)
+	}
+
+	if err := fw.Close(); err != nil {
+		return nil, fmt.Errorf("error compress: flush: %w", err)
+	}
+
+	header := &zip.FileHeader{
+		Name:               dst,
+		Method:             zip.Deflate,
+		CRC32:              crc.Sum32(),
+		CompressedSize64:   uint64(data.Len()),
+		UncompressedSize64: uint64(n),
+		CreatorVersion:     zipVersion20,
+		ReaderVersion:      zipVersion20,
+	}
+
+	if !isASCII(dst) {
+		header.Flags |= zipFlagUTF8
+	}
+
+	b := data.Bytes()
+
+	if z.settings.Encryption != nil {
+		b, err = encryptZipEntry(z.settings.Encryption, header, b)
 		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &compressedZipEntry{header: header, data: b, sum: sum, size: uint64(n)}, nil
+}
+
+// writeEntry writes an entry compressed by compressEntry to the zip
+// failing entries are logged and skipped, only context errors are returned.
+func (z *ZipArchiver) writeEntry(ctx context.Context, e dirEntry,
+	c *compressedZipEntry, err error,
+) error {
+	if err == nil && c == nil {
+		z.exclude()
+	}
+
+	if err == nil && c != nil {
+		if c.stream {
+			err = z.writeToZip(ctx, c.src, e.dst)
+		} else if c.dir {
+			err = z.writeDir(e)
+		} else if err = z.writeRaw(c); err == nil {
+			z.record(e.dst, int64(c.size), c.header.Mode(), c.sum)
+		}
+	}
+
+	if err != nil {
+		if isContextError(err) {
 			return err
 		}
+
+		log.Printf("error ArchiveDir: write to zip %s: %s", e.src, err)
+
+		z.skip(e.src, err)
 	}
 
-	if err := z.writeToZip(src, dst); err != nil {
-		return err
+	return nil
+}
+
+// writeDir writes the directory entry e, directories are not listed in Entries.
+func (z *ZipArchiver) writeDir(e dirEntry) error {
+	header := &zip.FileHeader{
+		Name:     e.dst + "/",
+		Method:   zip.Store,
+		Modified: e.modTime,
+	}
+
+	header.SetMode(os.ModeDir | e.mode)
+
+	if _, err := z.zipWriter.CreateHeader(header); err != nil {
+		return fmt.Errorf("error writeDir: create %s: %w", header.Name, err)
+	}
+
+	return nil
+}
+
+func (z *ZipArchiver) writeRaw(c *compressedZipEntry) error {
+	w, err := z.zipWriter.CreateRaw(c.header)
+	if err != nil {
+		return fmt.Errorf("error writeRaw: create %s writer: %w", c.header.Name, err)
+	}
+
+	if _, err := w.Write(c.data); err != nil {
+		return fmt.Errorf("error writeRaw: write to zip: %w", err)
 	}
 
 	return nil
 }
 
 // ArchiveDir accepts an absolute path src  and any other path dst
-// loops recursively through src path and calls ArchiveFile on each encountered file
-// to add it  to zip file
+// loops recursively through src path and adds each encountered file to the zip
+// files are read and compressed by Concurrency workers, but written in lexical order
 // every symbolic link is evaluated if SymLink is set to true.
-func (z *ZipArchiver) ArchiveDir(src, dst string) error {
-	var err error
+func (z *ZipArchiver) ArchiveDir(ctx context.Context, src, dst string) error {
+	entries, err := collectDirEntries(ctx, z.settings, &z.entryLog, src, dst)
+	if err != nil {
+		return z.skipOnError(src, err)
+	}
 
-	if slices.Contains(z.settings.ExcludeList, src) {
-		return nil
+	return processOrdered(ctx, z.settings.Concurrency, entries,
+		z.compressEntry, z.writeEntry)
+}
+
+// ArchiveContent accepts a slice of bytes, dst path and mode
+// it creates a new dst file within the zip and write they bytes into it.
+func (z *ZipArchiver) ArchiveContent(ctx context.Context, src []byte, dst string, mode os.FileMode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	header, err := z.writeContent(ctx, src, dst, mode)
+	if err != nil {
+		return z.skipOnError(dst, err)
 	}
 
-	if z.settings.SymLink {
-		src, err = evaluateSymLink(src)
+	z.recordBytes(dst, header.Mode(), src)
+
+	return nil
+}
+
+func (z *ZipArchiver) writeContent(ctx context.Context, src []byte, dst string,
+	mode os.FileMode,
+) (*zip.FileHeader, error) {
+	if z.settings.Encryption != nil {
+		c, err := z.compress(ctx, bytes.NewReader(src), dst)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("error ArchiveContent: compress %s: %w", dst, err)
 		}
+
+		c.header.SetMode(mode)
+
+		return c.header, z.writeRaw(c)
 	}
 
-	entries, err := os.ReadDir(src)
+	header := &zip.FileHeader{
+		Name:   dst,
+		Method: zip.Deflate,
+	}
+
+	header.SetMode(mode)
+
+	w, err := z.zipWriter.CreateHeader(header)
 	if err != nil {
-		return fmt.Errorf("error ArchiveDir: read dirs under %s: %w", src, err)
+		return nil, fmt.Errorf("error ArchiveContent: append file %s to zip: %w",
+			dst, err)
 	}
 
-	for _, entry := range entries {
-		tmpPath := filepath.Join(src, entry.Name())
+	if _, err := w.Write(src); err != nil {
+		return nil, fmt.Errorf("error ArchiveContent: write to zip: %w", err)
+	}
 
-		if !entry.IsDir() {
-			relPathIndex := strings.Index(tmpPath, dst)
-			fPath := tmpPath
+	return header, nil
+}
 
-			if relPathIndex != -1 {
-				fPath = tmpPath[relPathIndex:]
-			}
+// MergeArchive copies the regular files of the zip or tar archive src selected
+// by filter, zip entries are copied without being recompressed unless the
+// output is encrypted, failing entries are logged and skipped.
+func (z *ZipArchiver) MergeArchive(ctx context.Context, src string, filter *SourceFilter) error {
+	return walkSourceArchive(ctx, src, filter, func(e *sourceEntry) error {
+		dst := filter.target(e.name)
 
-			if err := z.ArchiveFile(tmpPath, fPath); err != nil {
-				log.Printf("error ArchiveDir: write to zip %s: %s", tmpPath, err)
-			}
+		var err error
+
+		if e.zipFile != nil && z.settings.Encryption == nil {
+			err = z.copyRaw(ctx, e.zipFile, dst)
 		} else {
-			if err := z.ArchiveDir(tmpPath, dst); err != nil {
-				log.Printf("error ArchiveDir: write to zip %s: %s", tmpPath, err)
+			err = z.writeSourceEntry(ctx, e, dst)
+		}
+
+		if err != nil {
+			if isContextError(err) {
+				return err
 			}
+
+			log.Printf("error MergeArchive: copy %s from %s: %s", e.name, src, err)
+
+			z.skip(src+":"+e.name, err)
 		}
+
+		return nil
+	})
+}
+
+// copyRaw copies the compressed data of zf to the zip as dst
+// the content is only decompressed to compute its sha256.
+func (z *ZipArchiver) copyRaw(ctx context.Context, zf *zip.File, dst string) error {
+	if zf.Flags&zipFlagEncrypted != 0 {
+		return errors.New("error copyRaw: encrypted entries are not supported")
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("error copyRaw: open %s: %w", zf.Name, err)
+	}
+
+	defer rc.Close()
+
+	sum := sha256.New()
+
+	n, err := copyWithContext(ctx, sum, rc)
+	if err != nil {
+		return fmt.Errorf("error copyRaw: read %s: %w", zf.Name, err)
+	}
+
+	raw, err := zf.OpenRaw()
+	if err != nil {
+		return fmt.Errorf("error copyRaw: open raw %s: %w", zf.Name, err)
+	}
+
+	header := zf.FileHeader
+	header.Name = dst
+	header.Extra = stripZip64Extra(header.Extra)
+
+	if isASCII(dst) {
+		header.Flags &^= zipFlagUTF8
+	} else {
+		header.Flags |= zipFlagUTF8
 	}
 
+	w, err := z.zipWriter.CreateRaw(&header)
+	if err != nil {
+		return fmt.Errorf("error copyRaw: create %s writer: %w", dst, err)
+	}
+
+	if _, err := copyWithContext(ctx, w, raw); err != nil {
+		return fmt.Errorf("error copyRaw: write to zip: %w", err)
+	}
+
+	z.record(dst, n, header.Mode(), sum)
+
 	return nil
 }
 
-// ArchiveContent accepts a slice of bytes and dst path
-// it creates a new dst file within the zip and write they bytes into it.
-func (z *ZipArchiver) ArchiveContent(src []byte, dst string) error {
-	w, err := z.zipWriter.Create(dst)
+// writeSourceEntry compresses, and encrypts if Encryption is set,
+// the content of a source archive entry as dst.
+func (z *ZipArchiver) writeSourceEntry(ctx context.Context, e *sourceEntry, dst string) error {
+	rc, err := e.open()
 	if err != nil {
-		return fmt.Errorf("error ArchiveContent: append file %s to zip: %w",
-			dst, err)
+		return fmt.Errorf("error writeSourceEntry: open %s: %w", e.name, err)
 	}
 
-	if _, err := w.Write(src); err != nil {
-		return fmt.Errorf("error ArchiveContent: write to zip: %w", err)
+	defer rc.Close()
+
+	header := &zip.FileHeader{
+		Name:     dst,
+		Method:   zip.Deflate,
+		Modified: e.modTime,
+	}
+
+	header.SetMode(e.mode)
+
+	if z.settings.Encryption != nil {
+		n, sum, err := z.writeEncrypted(ctx, rc, header)
+		if err != nil {
+			return fmt.Errorf("error writeSourceEntry: %s: %w", e.name, err)
+		}
+
+		z.record(dst, n, header.Mode(), sum)
+
+		return nil
+	}
+
+	w, err := z.zipWriter.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("error writeSourceEntry: create %s writer: %w", dst, err)
+	}
+
+	sum := sha256.New()
+
+	n, err := copyWithContext(ctx, io.MultiWriter(w, sum), rc)
+	if err != nil {
+		return fmt.Errorf("error writeSourceEntry: write to zip: %w", err)
+	}
+
+	z.record(dst, n, header.Mode(), sum)
+
+	return nil
+}
+
+// writeManifest writes the manifest of every recorded entry
+// as the last entry of the zip.
+func (z *ZipArchiver) writeManifest(ctx context.Context) error {
+	if z.settings.Manifest == nil || ctx.Err() != nil {
+		return nil
+	}
+
+	if err := z.checkManifestPath(z.settings.Manifest.Path); err != nil {
+		return err
+	}
+
+	b, err := buildManifest(z.settings.Manifest.Format, z.entries)
+	if err != nil {
+		return err
+	}
+
+	if _, err := z.writeContent(ctx, b, z.settings.Manifest.Path, DefaultContentMode); err != nil {
+		return fmt.Errorf("error writeManifest: %w", err)
 	}
 
 	return nil
 }
 
-func (z *ZipArchiver) Open(zipName string, opts ...Options) error {
+// Open creates a temporary archive next to zipName
+// the archive is only moved to zipName by a successful Close.
+func (z *ZipArchiver) Open(ctx context.Context, zipName string, opts ...Options) error {
+	var err error
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
 	archiveSettings := &ArchiveSettings{
-		FileMode: DefaultArchiveMode,
+		FileMode:    DefaultArchiveMode,
+		Concurrency: runtime.NumCPU(),
 	}
 
 	for _, opt := range opts {
 		opt(archiveSettings)
 	}
 
-	f, err := os.OpenFile(zipName, os.O_APPEND|os.O_CREATE|os.O_RDWR, archiveSettings.FileMode)
+	if archiveSettings.ExcludeList != nil {
+		archiveSettings.ExcludeList, err = resolveExcludeList(archiveSettings.ExcludeList)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := createTmpArchive(zipName, archiveSettings.FileMode)
 	if err != nil {
 		return fmt.Errorf("error: Create zip file %s: %w", zipName, err)
 	}
 
 	z.zipFile = f
 	z.fileName = zipName
+	z.reset()
 	z.zipWriter = zip.NewWriter(f)
 	z.settings = archiveSettings
 
-	if z.settings.ExcludeList != nil {
-		z.settings.ExcludeList, err = resolveExcludeList(z.settings.ExcludeList)
-		if err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
-func (z *ZipArchiver) Close() error {
-	err := errors.Join(z.zipWriter.Close(), z.zipFile.Close())
+// Close flushes the archive and moves it to its final location
+// if ctx is done or flushing fails, the temporary archive is removed instead.
+func (z *ZipArchiver) Close(ctx context.Context) error {
+	err := errors.Join(z.writeManifest(ctx),
+		z.zipWriter.Close(),
+		z.zipFile.Close())
 	if err != nil {
+		return fmt.Errorf("error Close: %w",
+			errors.Join(err, removeTmpArchive(z.zipFile.Name())))
+	}
+
+	if err := commitTmpArchive(ctx, z.zipFile.Name(), z.fileName); err != nil {
 		return fmt.Errorf("error Close: %w", err)
 	}
 
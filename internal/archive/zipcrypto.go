@@ -0,0 +1,300 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"slices"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	ZipEncryptionAES256    = "aes256"
+	ZipEncryptionZipCrypto = "zipcrypto"
+)
+
+const (
+	// compression method marking WinZip AES encrypted entries.
+	zipMethodAES = 99
+	// general purpose flag marking an entry as encrypted.
+	zipFlagEncrypted = 0x1
+	// general purpose flag marking an entry whose crc and sizes follow its data.
+	zipFlagDataDescriptor = 0x8
+	// WinZip AES extra field header id.
+	zipExtraAES = 0x9901
+	// AE-2, the crc is not stored and the HMAC authenticates the data.
+	zipAESVendorVersion = 2
+	// AES-256.
+	zipAESStrength     = 3
+	zipAESKeySize      = 32
+	zipAESSaltSize     = 16
+	zipAESVerifierSize = 2
+	zipAESMACSize      = 10
+	zipAESIterations   = 1000
+	// size of the traditional PKWARE encryption header.
+	zipCryptoHeaderSize = 12
+)
+
+// EncryptionSettings describes how zip entries are encrypted.
+type EncryptionSettings struct {
+	// aes256 or zipcrypto
+	Method   string
+	Password string
+}
+
+// encryptZipEntry encrypts the compressed data of an entry described by header
+// and updates header to describe the encrypted entry for CreateRaw.
+func encryptZipEntry(settings *EncryptionSettings, header *zip.FileHeader, data []byte) ([]byte, error) {
+	if err := encryptZipHeader(settings, header); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+
+	ew, err := newZipEncryptWriter(settings, header, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ew.Write(data); err != nil {
+		return nil, fmt.Errorf("error encryptZipEntry: %w", err)
+	}
+
+	if err := ew.Close(); err != nil {
+		return nil, fmt.Errorf("error encryptZipEntry: %w", err)
+	}
+
+	header.CompressedSize64 = uint64(out.Len())
+
+	return out.Bytes(), nil
+}
+
+// encryptZipHeader updates header to describe an entry encrypted with settings,
+// it is called before header is passed to CreateRaw.
+func encryptZipHeader(settings *EncryptionSettings, header *zip.FileHeader) error {
+	switch settings.Method {
+	case ZipEncryptionAES256, "":
+		extra := make([]byte, 11)
+		binary.LittleEndian.PutUint16(extra[0:], zipExtraAES)
+		binary.LittleEndian.PutUint16(extra[2:], 7)
+		binary.LittleEndian.PutUint16(extra[4:], zipAESVendorVersion)
+		copy(extra[6:], "AE")
+		extra[8] = zipAESStrength
+		binary.LittleEndian.PutUint16(extra[9:], header.Method)
+
+		header.Extra = append(header.Extra, extra...)
+		header.Method = zipMethodAES
+		header.CRC32 = 0
+		header.ReaderVersion = zipVersion51
+		header.CreatorVersion = zipVersion51
+	case ZipEncryptionZipCrypto:
+	default:
+		return fmt.Errorf("error encryptZipHeader: unsupported encryption method %s",
+			settings.Method)
+	}
+
+	header.Flags |= zipFlagEncrypted
+
+	return nil
+}
+
+// zipEncryptWriter encrypts the compressed data of an entry as it is written
+// so entries of any size are encrypted without being held in memory.
+type zipEncryptWriter struct {
+	w      io.Writer
+	stream cipher.Stream
+	// AE-2 HMAC-SHA1 of the encrypted data, nil for zipcrypto.
+	mac hash.Hash
+	buf []byte
+	// bytes written to w, the compressed size of the entry.
+	n int64
+}
+
+// newZipEncryptWriter writes the encryption header of the entry described
+// by header, updated by encryptZipHeader, to w and returns a writer
+// encrypting the compressed data to w.
+func newZipEncryptWriter(settings *EncryptionSettings, header *zip.FileHeader,
+	w io.Writer,
+) (*zipEncryptWriter, error) {
+	ew := &zipEncryptWriter{w: w}
+
+	var (
+		prefix []byte
+		err    error
+	)
+
+	switch settings.Method {
+	case ZipEncryptionAES256, "":
+		prefix, ew.stream, ew.mac, err = newZipAESStream(settings.Password)
+	case ZipEncryptionZipCrypto:
+		prefix, ew.stream, err = newZipCryptoStream(header, settings.Password)
+	default:
+		err = fmt.Errorf("unsupported encryption method %s", settings.Method)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error newZipEncryptWriter: %w", err)
+	}
+
+	if err := ew.write(prefix); err != nil {
+		return nil, fmt.Errorf("error newZipEncryptWriter: write header: %w", err)
+	}
+
+	return ew, nil
+}
+
+func (ew *zipEncryptWriter) Write(p []byte) (int, error) {
+	ew.buf = slices.Grow(ew.buf[:0], len(p))[:len(p)]
+	ew.stream.XORKeyStream(ew.buf, p)
+
+	if ew.mac != nil {
+		ew.mac.Write(ew.buf)
+	}
+
+	if err := ew.write(ew.buf); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (ew *zipEncryptWriter) write(p []byte) error {
+	n, err := ew.w.Write(p)
+	ew.n += int64(n)
+
+	return err
+}
+
+// Close writes the truncated HMAC ending AES entries, it does not close w.
+func (ew *zipEncryptWriter) Close() error {
+	if ew.mac == nil {
+		return nil
+	}
+
+	return ew.write(ew.mac.Sum(nil)[:zipAESMACSize])
+}
+
+// newZipAESStream derives the WinZip AE-2 keys of password from a random salt,
+// it returns the salt and password verifier preceding the encrypted data,
+// the AES-256-CTR stream and the HMAC-SHA1 following it.
+func newZipAESStream(password string) ([]byte, cipher.Stream, hash.Hash, error) {
+	salt := make([]byte, zipAESSaltSize)
+
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, nil, fmt.Errorf("generate salt: %w", err)
+	}
+
+	keys := pbkdf2.Key([]byte(password), salt, zipAESIterations,
+		2*zipAESKeySize+zipAESVerifierSize, sha1.New)
+
+	block, err := aes.NewCipher(keys[:zipAESKeySize])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("create cipher: %w", err)
+	}
+
+	stream := &zipAESCTR{block: block, used: aes.BlockSize}
+	mac := hmac.New(sha1.New, keys[zipAESKeySize:2*zipAESKeySize])
+
+	return append(salt, keys[2*zipAESKeySize:]...), stream, mac, nil
+}
+
+// zipAESCTR is the CTR mode of WinZip, with a little endian counter starting at 1,
+// crypto/cipher only implements big endian counters.
+type zipAESCTR struct {
+	block     cipher.Block
+	counter   [aes.BlockSize]byte
+	keyStream [aes.BlockSize]byte
+	// bytes of keyStream already used.
+	used int
+}
+
+func (s *zipAESCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.used == aes.BlockSize {
+			for j := range s.counter {
+				s.counter[j]++
+				if s.counter[j] != 0 {
+					break
+				}
+			}
+
+			s.block.Encrypt(s.keyStream[:], s.counter[:])
+			s.used = 0
+		}
+
+		dst[i] = src[i] ^ s.keyStream[s.used]
+		s.used++
+	}
+}
+
+// zipCryptoKeys is the state of the traditional PKWARE stream cipher.
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+
+	return k
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) encrypt(b byte) byte {
+	t := k[2] | 2
+	c := b ^ byte((t*(t^1))>>8)
+	k.update(b)
+
+	return c
+}
+
+func (k *zipCryptoKeys) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		dst[i] = k.encrypt(src[i])
+	}
+}
+
+// newZipCryptoStream returns the encrypted header preceding the data of the entry
+// described by header and the traditional PKWARE cipher encrypting the data,
+// it is weak and only meant for receivers not supporting AES.
+func newZipCryptoStream(header *zip.FileHeader, password string) ([]byte, cipher.Stream, error) {
+	encHeader := make([]byte, zipCryptoHeaderSize)
+
+	if _, err := rand.Read(encHeader[:zipCryptoHeaderSize-1]); err != nil {
+		return nil, nil, fmt.Errorf("generate header: %w", err)
+	}
+
+	// the last header byte lets readers check the password, the crc of
+	// entries followed by a data descriptor is not known yet, so their
+	// modification time is used instead.
+	encHeader[zipCryptoHeaderSize-1] = byte(header.CRC32 >> 24)
+
+	if header.Flags&zipFlagDataDescriptor != 0 {
+		encHeader[zipCryptoHeaderSize-1] = byte(header.ModifiedTime >> 8)
+	}
+
+	keys := newZipCryptoKeys(password)
+	keys.XORKeyStream(encHeader, encHeader)
+
+	return encHeader, keys, nil
+}
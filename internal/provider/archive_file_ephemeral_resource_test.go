@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-testing/echoprovider"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/tfversion"
+)
+
+func TestACCArchiveFileEphemeralResource(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_10_0),
+		},
+		ProtoV6ProviderFactories: map[string]func() (tfprotov6.ProviderServer, error){
+			"archiver": testAccProtoV6ProviderFactories["archiver"],
+			"echo":     echoprovider.NewProviderServer(),
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: providerConfig + `
+ephemeral "archiver_file" "test" {
+  name = "test.zip"
+  type = "zip"
+
+  include_base64 = true
+
+  file {
+    path = "../../internal/provider/provider.go"
+  }
+
+  content {
+    text = "content"
+    file_path = "content.txt"
+  }
+}
+
+provider "echo" {
+  data = ephemeral.archiver_file.test
+}
+
+resource "echo" "test" {}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("echo.test", "data.name", "test.zip"),
+					resource.TestCheckResourceAttr("echo.test", "data.type", "zip"),
+					resource.TestCheckResourceAttrSet("echo.test", "data.abs_path"),
+					resource.TestCheckResourceAttrSet("echo.test", "data.md5"),
+					resource.TestCheckResourceAttrSet("echo.test", "data.sha256"),
+					resource.TestCheckResourceAttrSet("echo.test", "data.size"),
+					resource.TestCheckResourceAttrSet("echo.test", "data.output_base64"),
+				),
+			},
+		},
+	})
+}
+
+func TestACCArchiveFileEphemeralResource_InvalidConfig(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		TerraformVersionChecks: []tfversion.TerraformVersionCheck{
+			tfversion.SkipBelow(tfversion.Version1_10_0),
+		},
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: providerConfig + `
+ephemeral "archiver_file" "test" {
+  name = "test.zip"
+  type = "zip"
+
+  content {
+    text = "content"
+    base64 = "Y29udGVudA=="
+    file_path = "content.txt"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile("exactly one of text and base64"),
+			},
+			{
+				Config: providerConfig + `
+ephemeral "archiver_file" "test" {
+  name = "test.zip"
+  type = "zip"
+
+  owner = "root"
+
+  file {
+    path = "../../internal/provider/provider.go"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile("only supported for tar archives"),
+			},
+			{
+				Config: providerConfig + `
+ephemeral "archiver_file" "test" {
+  name = "test.tar.gz"
+  type = "tar.gz"
+
+  file {
+    path = "../../internal/provider/provider.go"
+    uid = -1
+  }
+}
+`,
+				ExpectError: regexp.MustCompile("uid -1 must not be negative"),
+			},
+		},
+	})
+}
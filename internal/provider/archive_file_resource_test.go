@@ -1,9 +1,11 @@
 package provider
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/Wa4h1h/terraform-provider-archiver/internal/archive"
@@ -128,11 +130,90 @@ resource "archiver_file" "test" {
     src = base64encode("content")
     file_path = "content.txt"
   }
+
+  content {
+    text = "text"
+    file_path = "text.txt"
+  }
+
+  nested {
+    file_path = "lib/app.zip"
+    type = "zip"
+
+    file {
+      path = "../../internal/provider/provider.go"
+    }
+
+    content {
+      text = "nested"
+      file_path = "nested.txt"
+    }
+  }
 }
 `, Check: resource.ComposeAggregateTestCheckFunc(
 					resource.TestCheckResourceAttr("archiver_file.test", "name", "example.zip"),
 					resource.TestCheckResourceAttr("archiver_file.test", "type", "tar.gz"),
-					resource.TestCheckResourceAttr("archiver_file.test", "out_mode", "666")),
+					resource.TestCheckResourceAttr("archiver_file.test", "out_mode", "666"),
+					resource.TestCheckTypeSetElemNestedAttrs("archiver_file.test", "content.*",
+						map[string]string{
+							"text":      "text",
+							"file_path": "text.txt",
+						}),
+					resource.TestCheckTypeSetElemNestedAttrs("archiver_file.test", "nested.*",
+						map[string]string{
+							"file_path": "lib/app.zip",
+							"type":      "zip",
+						})),
+			},
+			{
+				Config: providerConfig + `
+resource "archiver_file" "test" {
+  name = "base64.zip"
+  type = "zip"
+
+  include_base64 = true
+  base64_max_size = "1MiB"
+
+  content {
+    text = "content"
+    file_path = "content.txt"
+  }
+}
+`, Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("archiver_file.test", "base64_max_size", "1MiB"),
+					func(s *terraform.State) error {
+						for _, r := range s.Modules[0].Resources {
+							b, err := os.ReadFile(r.Primary.Attributes["abs_path"])
+							if err != nil {
+								return err
+							}
+
+							encoded := base64.StdEncoding.EncodeToString(b)
+							if encoded != r.Primary.Attributes["output_base64"] {
+								return fmt.Errorf("expected output_base64 %s but got %s",
+									encoded, r.Primary.Attributes["output_base64"])
+							}
+						}
+
+						return nil
+					}),
+			},
+			{
+				Config: providerConfig + `
+resource "archiver_file" "test" {
+  name = "base64.zip"
+  type = "zip"
+
+  include_base64 = true
+  base64_max_size = "1B"
+
+  content {
+    text = "content"
+    file_path = "content.txt"
+  }
+}
+`,
+				ExpectError: regexp.MustCompile("archive too big for output_base64"),
 			},
 		},
 	})
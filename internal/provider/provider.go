@@ -6,12 +6,18 @@ import (
 	"github.com/Wa4h1h/terraform-provider-archiver/internal/archive"
 
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/function"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 )
 
 // make sure we conform to provider.Provider.
-var _ provider.Provider = &ArchiverProvider{}
+var (
+	_ provider.Provider                       = &ArchiverProvider{}
+	_ provider.ProviderWithFunctions          = &ArchiverProvider{}
+	_ provider.ProviderWithEphemeralResources = &ArchiverProvider{}
+)
 
 type ArchiverProvider struct {
 	version string
@@ -56,3 +62,19 @@ func (t *ArchiverProvider) Resources(_ context.Context,
 		archive.NewArchiveResource,
 	}
 }
+
+func (t *ArchiverProvider) EphemeralResources(_ context.Context,
+) []func() ephemeral.EphemeralResource {
+	return []func() ephemeral.EphemeralResource{
+		archive.NewArchiveEphemeralResource,
+	}
+}
+
+func (t *ArchiverProvider) Functions(_ context.Context,
+) []func() function.Function {
+	return []func() function.Function{
+		archive.NewDirHashFunction,
+		archive.NewListEntriesFunction,
+		archive.NewEntryContentFunction,
+	}
+}